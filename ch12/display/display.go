@@ -8,19 +8,39 @@ package display
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"sort"
 	"strconv"
 )
 
 //!+Display
 
 func Display(name string, x interface{}) {
-	fmt.Printf("Display %s (%T):\n", name, x)
-	display(name, reflect.ValueOf(x))
+	Fprint(os.Stdout, name, x, Options{})
 }
 
 //!-Display
 
+// Options controls how much of a value Fprint displays.
+// The zero value displays everything, with maps in iteration order.
+type Options struct {
+	MaxDepth int  // levels of composite values to expand; 0 means no limit
+	MaxElems int  // elements of each slice, array or map; 0 means no limit
+	SortKeys bool // display map entries in increasing key order
+}
+
+// Fprint writes to w a display of the value x, whose name is name.
+// Each pointer, map and slice is expanded only once: a later path to
+// the same one, including a cycle, is displayed as a back-reference
+// of the form "path = <ref earlier-path>".
+func Fprint(w io.Writer, name string, x interface{}, opts Options) {
+	fmt.Fprintf(w, "Display %s (%T):\n", name, x)
+	p := &printer{w: w, opts: opts, seen: make(map[ref]string)}
+	p.display(name, reflect.ValueOf(x), 0)
+}
+
 // formatAtom formats a value without inspecting its internal structure.
 // It is a copy of the the function in gopl.io/ch11/format.
 func formatAtom(v reflect.Value) string {
@@ -33,7 +53,10 @@ func formatAtom(v reflect.Value) string {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return strconv.FormatUint(v.Uint(), 10)
-	// ...floating-point and complex cases omitted for brevity...
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
 	case reflect.Bool:
 		if v.Bool() {
 			return "true"
@@ -50,41 +73,161 @@ func formatAtom(v reflect.Value) string {
 	}
 }
 
+// FormatAtom formats v without inspecting its internal structure,
+// as Fprint displays map keys and values of basic types.
+func FormatAtom(v reflect.Value) string { return formatAtom(v) }
+
+// A ref identifies the variables of a pointer, map or slice.
+// The type distinguishes a struct from its first field,
+// and the length one slice from a prefix of it.
+type ref struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type printer struct {
+	w    io.Writer
+	opts Options
+	seen map[ref]string // path at which each reference was expanded
+}
+
 //!+display
-func display(path string, v reflect.Value) {
+func (p *printer) display(path string, v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map,
+		reflect.Ptr, reflect.Interface:
+		if p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth &&
+			!isNil(v) {
+			fmt.Fprintf(p.w, "%s = %s ...\n", path, v.Type())
+			return
+		}
+		if p.backRef(path, v) {
+			return
+		}
+	}
+
 	switch v.Kind() {
 	case reflect.Invalid:
-		fmt.Printf("%s = invalid\n", path)
+		fmt.Fprintf(p.w, "%s = invalid\n", path)
 	case reflect.Slice, reflect.Array:
-		for i := 0; i < v.Len(); i++ {
-			display(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		n := p.limit(v.Len())
+		for i := 0; i < n; i++ {
+			p.display(fmt.Sprintf("%s[%d]", path, i), v.Index(i), depth+1)
 		}
+		p.more(path, v.Len()-n)
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
 			fieldPath := fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name)
-			display(fieldPath, v.Field(i))
+			p.display(fieldPath, v.Field(i), depth+1)
 		}
 	case reflect.Map:
-		for _, key := range v.MapKeys() {
-			display(fmt.Sprintf("%s[%s]", path,
-				formatAtom(key)), v.MapIndex(key))
+		keys := v.MapKeys()
+		if p.opts.SortKeys {
+			sort.Slice(keys, func(i, j int) bool {
+				return less(keys[i], keys[j])
+			})
 		}
+		n := p.limit(len(keys))
+		for _, key := range keys[:n] {
+			p.display(fmt.Sprintf("%s[%s]", path,
+				formatAtom(key)), v.MapIndex(key), depth+1)
+		}
+		p.more(path, len(keys)-n)
 	case reflect.Ptr:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
+			fmt.Fprintf(p.w, "%s = nil\n", path)
 		} else {
-			display(fmt.Sprintf("(*%s)", path), v.Elem())
+			p.display(fmt.Sprintf("(*%s)", path), v.Elem(), depth+1)
 		}
 	case reflect.Interface:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
+			fmt.Fprintf(p.w, "%s = nil\n", path)
 		} else {
-			fmt.Printf("%s.type = %s\n", path, v.Elem().Type())
-			display(path+".value", v.Elem())
+			fmt.Fprintf(p.w, "%s.type = %s\n", path, v.Elem().Type())
+			p.display(path+".value", v.Elem(), depth+1)
 		}
 	default: // basic types, channels, funcs
-		fmt.Printf("%s = %s\n", path, formatAtom(v))
+		fmt.Fprintf(p.w, "%s = %s\n", path, formatAtom(v))
 	}
 }
 
 //!-display
+
+// backRef reports whether the pointer, map or slice v has already
+// been expanded, and if so displays a back-reference to it.
+// Otherwise it records path as the place where v is expanded.
+func (p *printer) backRef(path string, v reflect.Value) bool {
+	var r ref
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type().Elem().Size() == 0 {
+			return false // zero-sized variables may share an address
+		}
+		r = ref{v.Pointer(), v.Type(), 0}
+		path = "(*" + path + ")"
+	case reflect.Map:
+		if v.IsNil() || v.Len() == 0 {
+			return false
+		}
+		r = ref{v.Pointer(), v.Type(), 0}
+	case reflect.Slice:
+		if v.Len() == 0 || v.Type().Elem().Size() == 0 {
+			return false
+		}
+		r = ref{v.Pointer(), v.Type(), v.Len()}
+	default:
+		return false
+	}
+	if prev, ok := p.seen[r]; ok {
+		fmt.Fprintf(p.w, "%s = <ref %s>\n", path, prev)
+		return true
+	}
+	p.seen[r] = path
+	return false
+}
+
+// limit returns how many of n elements to display.
+func (p *printer) limit(n int) int {
+	if p.opts.MaxElems > 0 && n > p.opts.MaxElems {
+		return p.opts.MaxElems
+	}
+	return n
+}
+
+// more displays a note about n elements that were not displayed.
+func (p *printer) more(path string, n int) {
+	if n > 0 {
+		fmt.Fprintf(p.w, "%s[...] = <%d more>\n", path, n)
+	}
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Less reports whether map key x sorts before key y, in the order
+// in which Fprint displays keys when Options.SortKeys is set.
+func Less(x, y reflect.Value) bool { return less(x, y) }
+
+// less orders map keys: numbers and strings by value,
+// and other keys by their formatted text.
+func less(x, y reflect.Value) bool {
+	switch x.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return x.Int() < y.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() < y.Uint()
+	case reflect.Float32, reflect.Float64:
+		return x.Float() < y.Float()
+	case reflect.String:
+		return x.String() < y.String()
+	}
+	return formatAtom(x) < formatAtom(y)
+}
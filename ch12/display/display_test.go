@@ -211,34 +211,28 @@ func Test(t *testing.T) {
 	type P *P
 	var p P
 	p = &p
-	if false {
-		Display("p", p)
-		// Output:
-		// Display p (display.P):
-		// ...stuck, no output...
-	}
+	Display("p", p)
+	// Output:
+	// Display p (display.P):
+	// (*(*p)) = <ref (*p)>
 
 	// a map that contains itself
 	type M map[string]M
 	m := make(M)
 	m[""] = m
-	if false {
-		Display("m", m)
-		// Output:
-		// Display m (display.M):
-		// ...stuck, no output...
-	}
+	Display("m", m)
+	// Output:
+	// Display m (display.M):
+	// m[""] = <ref m>
 
 	// a slice that contains itself
 	type S []S
 	s := make(S, 1)
 	s[0] = s
-	if false {
-		Display("s", s)
-		// Output:
-		// Display s (display.S):
-		// ...stuck, no output...
-	}
+	Display("s", s)
+	// Output:
+	// Display s (display.S):
+	// s[0] = <ref s>
 
 	// a linked list that eats its own tail
 	type Cycle struct {
@@ -247,13 +241,73 @@ func Test(t *testing.T) {
 	}
 	var c Cycle
 	c = Cycle{42, &c}
-	if false {
-		Display("c", c)
-		// Output:
-		// Display c (display.Cycle):
-		// c.Value = 42
-		// (*c.Tail).Value = 42
-		// (*(*c.Tail).Tail).Value = 42
-		// ...ad infinitum...
+	Display("c", c)
+	// Output:
+	// Display c (display.Cycle):
+	// c.Value = 42
+	// (*c.Tail).Value = 42
+	// (*(*c.Tail).Tail) = <ref (*c.Tail)>
+}
+
+func Example_cycle() {
+	type Cycle struct {
+		Value int
+		Tail  *Cycle
 	}
+	head := &Cycle{1, nil}
+	head.Tail = &Cycle{2, head}
+	Display("head", head)
+	// Output:
+	// Display head (*display.Cycle):
+	// (*head).Value = 1
+	// (*(*head).Tail).Value = 2
+	// (*(*(*head).Tail).Tail) = <ref (*head)>
+}
+
+func Example_numbers() {
+	Display("x", []interface{}{1.5, float32(0.1), complex(1, -2)})
+	// Output:
+	// Display x ([]interface {}):
+	// x[0].type = float64
+	// x[0].value = 1.5
+	// x[1].type = float32
+	// x[1].value = 0.1
+	// x[2].type = complex128
+	// x[2].value = (1-2i)
+}
+
+func ExampleFprint() {
+	type Movie struct {
+		Title  string
+		Actor  map[string]string
+		Oscars []string
+	}
+	movie := Movie{
+		Title: "Dr. Strangelove",
+		Actor: map[string]string{
+			"Dr. Strangelove":           "Peter Sellers",
+			"Gen. Buck Turgidson":       "George C. Scott",
+			"Brig. Gen. Jack D. Ripper": "Sterling Hayden",
+		},
+		Oscars: []string{
+			"Best Actor (Nomin.)",
+			"Best Adapted Screenplay (Nomin.)",
+			"Best Director (Nomin.)",
+		},
+	}
+	Fprint(os.Stdout, "movie", movie, Options{MaxElems: 2, SortKeys: true})
+	Fprint(os.Stdout, "&movie", &movie, Options{MaxDepth: 2})
+	// Output:
+	// Display movie (display.Movie):
+	// movie.Title = "Dr. Strangelove"
+	// movie.Actor["Brig. Gen. Jack D. Ripper"] = "Sterling Hayden"
+	// movie.Actor["Dr. Strangelove"] = "Peter Sellers"
+	// movie.Actor[...] = <1 more>
+	// movie.Oscars[0] = "Best Actor (Nomin.)"
+	// movie.Oscars[1] = "Best Adapted Screenplay (Nomin.)"
+	// movie.Oscars[...] = <1 more>
+	// Display &movie (*display.Movie):
+	// (*&movie).Title = "Dr. Strangelove"
+	// (*&movie).Actor = map[string]string ...
+	// (*&movie).Oscars = []string ...
 }
@@ -0,0 +1,428 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package display
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An Inspector is an http.Handler that serves a collapsible HTML tree
+// of each registered value.  The tree is expanded lazily: each click
+// fetches the children of one node.  A pointer, map or slice that
+// refers back to a node on its own path is marked as a cycle, and one
+// that is reached twice on the page is marked as seen.
+//
+// An Inspector may be mounted at any path of a debug mux:
+//
+//	in := display.NewInspector()
+//	in.Register("cache", &cache, &cache.mu)
+//	http.Handle("/debug/values", in)
+type Inspector struct {
+	mu    sync.Mutex // guards roots
+	roots map[string]inspected
+}
+
+type inspected struct {
+	x    interface{}
+	lock sync.Locker
+}
+
+// NewInspector returns an Inspector with no values.
+func NewInspector() *Inspector {
+	return &Inspector{roots: make(map[string]inspected)}
+}
+
+// Register adds x, under the given name, to the values shown by in.
+// Usually x is a pointer, so that the tree shows the value's current
+// state.  The Inspector holds lock, if non-nil, while it reads x.
+func (in *Inspector) Register(name string, x interface{}, lock sync.Locker) {
+	in.mu.Lock()
+	in.roots[name] = inspected{x, lock}
+	in.mu.Unlock()
+}
+
+// Unregister removes the value of the given name.
+func (in *Inspector) Unregister(name string) {
+	in.mu.Lock()
+	delete(in.roots, name)
+	in.mu.Unlock()
+}
+
+// maxChildren limits the number of elements shown for each node.
+const maxChildren = 1000
+
+// A node is one line of the tree.
+type node struct {
+	Label  string // field name, index or key
+	Type   string
+	Value  string // for atoms
+	Root   string // name of the registered root
+	Path   string // path from the root, if expandable
+	Where  string // display-style path, such as root.Field[3]
+	Ptr    string // identity of a pointer, map or slice
+	Cycle  string // Where of the ancestor it refers to
+	Expand bool
+}
+
+// ServeHTTP serves the page listing all values, or, if the request
+// has a root parameter, the children of the node at the given path.
+func (in *Inspector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := req.FormValue("root")
+	if name == "" {
+		in.page(w)
+		return
+	}
+	in.mu.Lock()
+	r, ok := in.roots[name]
+	in.mu.Unlock()
+	if !ok {
+		http.Error(w, "no such value: "+name, http.StatusNotFound)
+		return
+	}
+
+	// Hold the lock only while reading the value, not while
+	// writing the response, which a slow client may delay.
+	path := req.FormValue("path")
+	nodes, err := func() ([]node, error) {
+		if r.lock != nil {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+		}
+		v, where, ancestors, err := resolve(name, reflect.ValueOf(r.x), path)
+		if err != nil {
+			return nil, err
+		}
+		return children(name, path, where, v, ancestors), nil
+	}()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := fragment.Execute(w, nodes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (in *Inspector) page(w http.ResponseWriter) {
+	in.mu.Lock()
+	var names []string
+	for name := range in.roots {
+		names = append(names, name)
+	}
+	roots := make(map[string]inspected, len(in.roots))
+	for name, r := range in.roots {
+		roots[name] = r
+	}
+	in.mu.Unlock()
+	sort.Strings(names)
+
+	var nodes []node
+	for _, name := range names {
+		r := roots[name]
+		if r.lock != nil {
+			r.lock.Lock()
+		}
+		n := newNode(name, name, "", name, reflect.ValueOf(r.x), nil)
+		if r.lock != nil {
+			r.lock.Unlock()
+		}
+		nodes = append(nodes, n)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, nodes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// A path is a sequence of steps separated by '/', each escaped by
+// escapeStep: "f3" selects field 3 of a struct, "i5" element 5 of
+// an array or slice, and "k" followed by a key formatted by formatAtom
+// selects a map entry.  Pointers and interfaces are followed implicitly.
+
+// resolve returns the value at path from v, the root of the given
+// name, following pointers and interfaces.  It also returns the
+// display-style label of the value, and the identities of the
+// references on the way, mapped to their labels.
+func resolve(name string, v reflect.Value, path string) (_ reflect.Value, label string, _ map[ref]string, _ error) {
+	ancestors := make(map[ref]string)
+	label = name
+	v = deref(v, ancestors, label)
+	if path == "" {
+		return v, label, ancestors, nil
+	}
+	for _, step := range strings.Split(path, "/") {
+		step = unescapeStep(step)
+		if step == "" {
+			return v, "", nil, fmt.Errorf("empty step in path %q", path)
+		}
+		arg := step[1:]
+		switch {
+		case step[0] == 'f' && v.Kind() == reflect.Struct:
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < 0 || i >= v.NumField() {
+				return v, "", nil, fmt.Errorf("no field %s in %s", arg, v.Type())
+			}
+			label += "." + v.Type().Field(i).Name
+			v = v.Field(i)
+		case step[0] == 'i' && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < 0 || i >= v.Len() {
+				return v, "", nil, fmt.Errorf("no index %s in %s", arg, v.Type())
+			}
+			label += "[" + arg + "]"
+			v = v.Index(i)
+		case step[0] == 'k' && v.Kind() == reflect.Map:
+			k, ok := findKey(v, arg)
+			if !ok {
+				return v, "", nil, fmt.Errorf("no key %s in %s", arg, v.Type())
+			}
+			label += "[" + arg + "]"
+			v = v.MapIndex(k)
+		default:
+			return v, "", nil, fmt.Errorf("bad step %q for %s", step, v.Type())
+		}
+		v = deref(v, ancestors, label)
+	}
+	return v, label, ancestors, nil
+}
+
+// deref follows pointers and interfaces from v, recording the
+// identity of each reference in ancestors.
+func deref(v reflect.Value, ancestors map[ref]string, label string) reflect.Value {
+	for {
+		if r, ok := refOf(v); ok {
+			if _, dup := ancestors[r]; dup {
+				return v // a cycle; stop
+			}
+			ancestors[r] = label
+		}
+		if (v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface) || v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+}
+
+func findKey(m reflect.Value, text string) (reflect.Value, bool) {
+	for _, k := range m.MapKeys() {
+		if formatAtom(k) == text {
+			return k, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// refOf returns the identity of a non-nil pointer, map or slice.
+func refOf(v reflect.Value) (ref, bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type().Elem().Size() == 0 {
+			return ref{}, false // zero-sized variables may share an address
+		}
+		return ref{v.Pointer(), v.Type(), 0}, true
+	case reflect.Map:
+		if v.IsNil() {
+			return ref{}, false
+		}
+		return ref{v.Pointer(), v.Type(), 0}, true
+	case reflect.Slice:
+		if v.Len() == 0 || v.Type().Elem().Size() == 0 {
+			return ref{}, false
+		}
+		return ref{v.Pointer(), v.Type(), v.Len()}, true
+	}
+	return ref{}, false
+}
+
+// children returns the nodes for the elements of v, the value at
+// path from the named root, whose label is where.
+func children(root, path, where string, v reflect.Value, ancestors map[ref]string) []node {
+	join := func(step string) string {
+		step = escapeStep(step)
+		if path == "" {
+			return step
+		}
+		return path + "/" + step
+	}
+	var nodes []node
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			nodes = append(nodes, newNode(name, root, join("f"+strconv.Itoa(i)),
+				where+"."+name, v.Field(i), ancestors))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len() && i < maxChildren; i++ {
+			label := "[" + strconv.Itoa(i) + "]"
+			nodes = append(nodes, newNode(label, root, join("i"+strconv.Itoa(i)),
+				where+label, v.Index(i), ancestors))
+		}
+		if v.Len() > maxChildren {
+			nodes = append(nodes, node{Label: "...",
+				Value: fmt.Sprintf("%d more", v.Len()-maxChildren)})
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+		for i, k := range keys {
+			if i == maxChildren {
+				nodes = append(nodes, node{Label: "...",
+					Value: fmt.Sprintf("%d more", len(keys)-maxChildren)})
+				break
+			}
+			text := formatAtom(k)
+			nodes = append(nodes, newNode("["+text+"]", root, join("k"+text),
+				where+"["+text+"]", v.MapIndex(k), ancestors))
+		}
+	}
+	return nodes
+}
+
+// newNode returns the node for value v, with the given label,
+// path from the root, and display-style path.
+func newNode(label, root, path, where string, v reflect.Value, ancestors map[ref]string) node {
+	n := node{Label: label, Root: root, Path: path, Where: where}
+	if !v.IsValid() {
+		n.Value = "invalid"
+		return n
+	}
+	n.Type = v.Type().String()
+	if r, ok := refOf(v); ok {
+		n.Ptr = fmt.Sprintf("%s@%x/%d", r.typ, r.ptr, r.len)
+	}
+
+	// Look through pointers and interfaces to the value they hold,
+	// stopping at a reference to an ancestor.
+	e := v
+	for {
+		if r, ok := refOf(e); ok {
+			if l, ok := ancestors[r]; ok {
+				n.Cycle = l
+				return n
+			}
+		}
+		if (e.Kind() != reflect.Ptr && e.Kind() != reflect.Interface) || e.IsNil() {
+			break
+		}
+		e = e.Elem()
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		n.Type += " (" + v.Elem().Type().String() + ")"
+	}
+	switch e.Kind() {
+	case reflect.Struct:
+		n.Expand = e.NumField() > 0
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n.Expand = e.Len() > 0
+	}
+	if e.Kind() == reflect.Slice || e.Kind() == reflect.Map {
+		n.Type += " len " + strconv.Itoa(e.Len())
+	}
+	if !n.Expand {
+		switch e.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			n.Value = "nil"
+		case reflect.Struct, reflect.Array:
+			n.Value = "{}"
+		default:
+			n.Value = formatAtom(e)
+		}
+	}
+	return n
+}
+
+// escapeStep escapes a path step so that it contains no '/';
+// unescapeStep reverses it.
+func escapeStep(s string) string {
+	return strings.NewReplacer("%", "%25", "/", "%2F").Replace(s)
+}
+
+func unescapeStep(s string) string {
+	return strings.NewReplacer("%2F", "/", "%25", "%").Replace(s)
+}
+
+const nodeTemplate = `{{define "node"}}<li>
+{{- if .Expand}}<span class="toggle" data-root="{{.Root}}" data-path="{{.Path}}">&#9656;</span> {{else}}<span class="leaf"></span> {{end -}}
+<span class="label"{{if .Ptr}} data-ptr="{{.Ptr}}" data-where="{{.Where}}"{{end}}>{{.Label}}</span>
+<span class="type">{{.Type}}</span>
+{{- if .Cycle}} <span class="cycle">&#8634; cycle to {{.Cycle}}</span>{{end}}
+{{- if .Value}} = <span class="value">{{.Value}}</span>{{end}}
+{{- if .Expand}}<ul class="children"></ul>{{end}}</li>
+{{end}}`
+
+var fragment = template.Must(template.New("fragment").Parse(
+	nodeTemplate + `{{range .}}{{template "node" .}}{{end}}`))
+
+var page = template.Must(template.New("page").Parse(nodeTemplate + `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Values</title>
+<style>
+body { font-family: monospace; }
+ul { list-style: none; padding-left: 1.5em; }
+.toggle { cursor: pointer; display: inline-block; width: 1em; }
+.toggle.open { transform: rotate(90deg); }
+.leaf { display: inline-block; width: 1em; }
+.type { color: #888; }
+.value { color: #06c; }
+.cycle, .seen { color: #c60; }
+</style>
+</head>
+<body>
+<ul class="tree">
+{{range .}}{{template "node" .}}{{end}}
+</ul>
+<script>
+// Mark each pointer, map or slice that appears earlier on the page.
+function markSeen() {
+	var first = {};
+	document.querySelectorAll("[data-ptr]").forEach(function(e) {
+		var p = e.dataset.ptr;
+		if (!(p in first)) {
+			first[p] = e;
+			return;
+		}
+		if (e.dataset.marked) {
+			return;
+		}
+		e.dataset.marked = "1";
+		var s = document.createElement("span");
+		s.className = "seen";
+		s.textContent = " \u21ba seen at " + first[p].dataset.where;
+		e.parentNode.querySelector(".type").after(s);
+	});
+}
+document.addEventListener("click", function(ev) {
+	var t = ev.target;
+	if (!t.classList.contains("toggle")) return;
+	var ul = t.parentNode.querySelector("ul.children");
+	if (t.classList.toggle("open")) {
+		ul.style.display = "";
+		if (!t.dataset.loaded) {
+			t.dataset.loaded = "1";
+			var q = "?root=" + encodeURIComponent(t.dataset.root) +
+				"&path=" + encodeURIComponent(t.dataset.path);
+			fetch(q).then(function(r) { return r.text(); }).then(function(html) {
+				ul.innerHTML = html;
+				markSeen();
+			});
+		}
+	} else {
+		ul.style.display = "none";
+	}
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,184 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package display
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingLock is a sync.Locker that counts its uses.
+type countingLock struct {
+	sync.Mutex
+	n int
+}
+
+func (l *countingLock) Lock() { l.Mutex.Lock(); l.n++ }
+
+func TestInspector(t *testing.T) {
+	type Cycle struct {
+		Value int
+		Tail  *Cycle
+		Tags  map[string]int
+	}
+	c := &Cycle{Value: 42, Tags: map[string]int{"a/b": 1}}
+	c.Tail = c
+
+	var lock countingLock
+	in := NewInspector()
+	in.Register("c", c, &lock)
+	in.Register("s", []string{"x", "y"}, nil)
+	in.Register("gone", 1, nil)
+	in.Unregister("gone")
+	ts := httptest.NewServer(in)
+	defer ts.Close()
+
+	get := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	children := func(root, path string) string {
+		t.Helper()
+		code, body := get("?root=" + url.QueryEscape(root) + "&path=" + url.QueryEscape(path))
+		if code != http.StatusOK {
+			t.Fatalf("root=%s path=%s: status %d: %s", root, path, code, body)
+		}
+		return body
+	}
+
+	// The page lists the roots, in order, but not their elements.
+	code, body := get("/")
+	if code != http.StatusOK {
+		t.Fatalf("page: status %d", code)
+	}
+	for _, want := range []string{
+		`data-root="c" data-path=""`,
+		`*display.Cycle`,
+		`data-root="s" data-path=""`,
+		`[]string len 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+	if strings.Index(body, `data-root="c"`) > strings.Index(body, `data-root="s"`) {
+		t.Errorf("page roots are not in order")
+	}
+	if strings.Contains(body, "gone") || strings.Contains(body, "Value</span>") {
+		t.Errorf("page shows more than the roots:\n%s", body)
+	}
+
+	// The children of the root are its fields, with a cycle in Tail.
+	body = children("c", "")
+	for _, want := range []string{
+		`Value</span>`,
+		`= <span class="value">42</span>`,
+		`cycle to c</span>`,
+		`data-path="f2"`,
+		`map[string]int len 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("children of c do not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `data-path="f1"`) {
+		t.Errorf("cyclic Tail is expandable:\n%s", body)
+	}
+
+	// Map keys are quoted; a '/' in a key survives the path syntax.
+	body = children("c", "f2")
+	if !strings.Contains(body, `[&#34;a/b&#34;]`) ||
+		!strings.Contains(body, `= <span class="value">1</span>`) {
+		t.Errorf("children of c.Tags:\n%s", body)
+	}
+
+	body = children("s", "")
+	if !strings.Contains(body, `[1]</span>`) ||
+		!strings.Contains(body, `<span class="value">&#34;y&#34;</span>`) {
+		t.Errorf("children of s:\n%s", body)
+	}
+
+	// The page and each request for c hold its lock.
+	if lock.n != 3 {
+		t.Errorf("lock used %d times, want 3", lock.n)
+	}
+
+	for _, query := range []string{
+		"?root=gone",
+		"?root=c&path=f9",
+		"?root=c&path=i0",
+		"?root=c&path=f2/k%22nope%22",
+		"?root=s&path=i2",
+		"?root=s&path=i0/i0",
+	} {
+		if code, _ := get(query); code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", query, code, http.StatusNotFound)
+		}
+	}
+}
+
+// A stalledWriter is an http.ResponseWriter whose Write blocks
+// until release is closed.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{} // closed when Write is first called
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+// TestInspectorSlowClient checks that the Inspector does not hold
+// a value's lock while it writes to a client.
+func TestInspectorSlowClient(t *testing.T) {
+	var mu sync.Mutex
+	in := NewInspector()
+	in.Register("s", []string{"x", "y"}, &mu)
+	w := &stalledWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		in.ServeHTTP(w, httptest.NewRequest("GET", "/?root=s&path=", nil))
+		close(done)
+	}()
+	<-w.writing
+	locked := make(chan struct{})
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Error("lock is held while writing the response")
+	}
+	close(w.release)
+	<-done
+	if !strings.Contains(w.Body.String(), `&#34;x&#34;`) {
+		t.Errorf("response does not contain the elements: %s", w.Body)
+	}
+}
@@ -4,19 +4,306 @@
 // See page 332.
 
 // Package format provides an Any function that can format any value.
-//!+
 package format
 
 import (
+	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
-// Any formats any value as a string.
+// Any formats any value as a string.  Composite values are formatted
+// as Go composite literals, such as []int{1, 2} or T{X: 1}, with map
+// entries in key order, and pointers as &elem.
+// A pointer, map or slice that refers to a value that encloses it
+// is formatted as <cycle>.
 func Any(value interface{}) string {
-	return formatAtom(reflect.ValueOf(value))
+	f := formatter{active: make(map[ref]bool)}
+	var b strings.Builder
+	f.format(&b, reflect.ValueOf(value), true)
+	return b.String()
+}
+
+// GoString formats any value as a Go expression that, in a package
+// that imports the packages named in it, evaluates to a value deeply
+// equal to value.  Zero-valued struct fields are omitted, map entries
+// are in key order, and pointers to non-composite values are built
+// by function literals, so the output is stable and suitable for
+// golden files.  Type names are as reported by reflect, qualified by
+// package name, so types of the calling package must be renamed.
+//
+// GoString reports an error for values that no Go expression can
+// produce: cycles, and non-nil channels, functions and unsafe pointers.
+func GoString(value interface{}) (string, error) {
+	f := formatter{goSyntax: true, active: make(map[ref]bool)}
+	var b strings.Builder
+	f.format(&b, reflect.ValueOf(value), true)
+	if f.err != nil {
+		return "", f.err
+	}
+	return b.String(), nil
+}
+
+// A ref identifies the variables of a pointer, map or slice.
+type ref struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type formatter struct {
+	goSyntax bool         // format as a Go expression
+	active   map[ref]bool // references enclosing the current value
+	err      error        // first error, in goSyntax mode
+}
+
+func (f *formatter) errorf(format string, args ...interface{}) {
+	if f.err == nil {
+		f.err = fmt.Errorf("format: "+format, args...)
+	}
+}
+
+// format writes v to b.  If typed, the context does not imply the
+// type of v, as for the elements of an interface, so the output must
+// carry its type; otherwise, the context has the type of v.
+func (f *formatter) format(b *strings.Builder, v reflect.Value, typed bool) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		b.WriteString("nil")
+
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		f.basic(b, v, typed)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			f.nil(b, v, typed)
+			return
+		}
+		if !f.enter(b, v) {
+			return
+		}
+		defer f.leave(v)
+		switch elem := v.Elem(); elem.Kind() {
+		case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+			b.WriteByte('&')
+			f.format(b, elem, true)
+		default:
+			if !f.goSyntax {
+				b.WriteByte('&')
+				f.format(b, elem, true)
+				return
+			}
+			// Only composite literals may have their address taken.
+			fmt.Fprintf(b, "func() %s { var v %s = ", v.Type(), elem.Type())
+			f.format(b, elem, false)
+			b.WriteString("; return &v }()")
+		}
+
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		f.format(b, v.Elem(), true)
+
+	case reflect.Struct:
+		b.WriteString(v.Type().String())
+		b.WriteByte('{')
+		sep := ""
+		for i := 0; i < v.NumField(); i++ {
+			if f.goSyntax && v.Field(i).IsZero() {
+				continue
+			}
+			b.WriteString(sep)
+			b.WriteString(v.Type().Field(i).Name)
+			b.WriteString(": ")
+			f.format(b, v.Field(i), false)
+			sep = ", "
+		}
+		b.WriteByte('}')
+
+	case reflect.Array, reflect.Slice:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			f.nil(b, v, typed)
+			return
+		}
+		if !f.enter(b, v) {
+			return
+		}
+		defer f.leave(v)
+		b.WriteString(v.Type().String())
+		b.WriteByte('{')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			f.format(b, v.Index(i), false)
+		}
+		b.WriteByte('}')
+
+	case reflect.Map:
+		if v.IsNil() {
+			f.nil(b, v, typed)
+			return
+		}
+		if !f.enter(b, v) {
+			return
+		}
+		defer f.leave(v)
+		type entry struct{ key, value string }
+		var entries []entry
+		for _, k := range v.MapKeys() {
+			var kb, vb strings.Builder
+			f.format(&kb, k, false)
+			f.format(&vb, v.MapIndex(k), false)
+			entries = append(entries, entry{kb.String(), vb.String()})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+		b.WriteString(v.Type().String())
+		b.WriteByte('{')
+		for i, e := range entries {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(e.key)
+			b.WriteString(": ")
+			b.WriteString(e.value)
+		}
+		b.WriteByte('}')
+
+	default: // reflect.Chan, reflect.Func, reflect.UnsafePointer
+		if v.IsNil() {
+			f.nil(b, v, typed)
+			return
+		}
+		if f.goSyntax {
+			f.errorf("cannot express a non-nil %s", v.Type())
+		}
+		b.WriteString(formatAtom(v))
+	}
+}
+
+// basic writes the value v of a boolean, numeric or string type.
+func (f *formatter) basic(b *strings.Builder, v reflect.Value, typed bool) {
+	if !f.goSyntax {
+		b.WriteString(formatAtom(v))
+		return
+	}
+	s := formatAtom(v)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if x := v.Float(); math.IsNaN(x) || math.IsInf(x, 0) {
+			// math.NaN() and math.Inf are not constants,
+			// so they must be converted even in a typed context.
+			fmt.Fprintf(b, "%s(%s)", v.Type(), goFloat(x, v.Type().Bits()))
+			return
+		}
+	case reflect.Complex64, reflect.Complex128:
+		c, bits := v.Complex(), v.Type().Bits()/2
+		if !isFinite(real(c)) || !isFinite(imag(c)) {
+			fmt.Fprintf(b, "%s(complex(%s, %s))", v.Type(),
+				goFloat(real(c), bits), goFloat(imag(c), bits))
+			return
+		}
+	}
+	// An untyped constant takes its type from the context,
+	// except where there is none.
+	if typed && !isDefault(v.Type()) {
+		fmt.Fprintf(b, "%s(%s)", v.Type(), s)
+		return
+	}
+	b.WriteString(s)
+}
+
+// nil writes the nil value v.
+func (f *formatter) nil(b *strings.Builder, v reflect.Value, typed bool) {
+	if f.goSyntax && typed {
+		fmt.Fprintf(b, "(%s)(nil)", v.Type())
+		return
+	}
+	b.WriteString("nil")
+}
+
+// enter records that the value referred to by the pointer, map or
+// slice v is being formatted.  If it already is, enter writes a
+// cycle marker, or records an error, and returns false.
+func (f *formatter) enter(b *strings.Builder, v reflect.Value) bool {
+	r, ok := refOf(v)
+	if !ok {
+		return true
+	}
+	if f.active[r] {
+		if f.goSyntax {
+			f.errorf("cycle through %s", v.Type())
+		} else {
+			b.WriteString("<cycle>")
+		}
+		return false
+	}
+	f.active[r] = true
+	return true
+}
+
+func (f *formatter) leave(v reflect.Value) {
+	if r, ok := refOf(v); ok {
+		delete(f.active, r)
+	}
 }
 
+func refOf(v reflect.Value) (ref, bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Size() == 0 {
+			return ref{}, false // zero-sized variables may share an address
+		}
+		return ref{v.Pointer(), v.Type(), 0}, true
+	case reflect.Map:
+		return ref{v.Pointer(), v.Type(), 0}, true
+	case reflect.Slice:
+		if v.Len() == 0 || v.Type().Elem().Size() == 0 {
+			return ref{}, false
+		}
+		return ref{v.Pointer(), v.Type(), v.Len()}, true
+	}
+	return ref{}, false // arrays are values
+}
+
+// isDefault reports whether t is the default type of an untyped
+// constant whose literal is formatted by formatAtom.
+func isDefault(t reflect.Type) bool {
+	switch t {
+	case reflect.TypeOf(false), reflect.TypeOf(0), reflect.TypeOf(""):
+		return true
+	}
+	return false
+}
+
+func isFinite(x float64) bool { return !math.IsNaN(x) && !math.IsInf(x, 0) }
+
+// goFloat returns a float64 expression for x.
+func goFloat(x float64, bits int) string {
+	switch {
+	case math.IsNaN(x):
+		return "math.NaN()"
+	case math.IsInf(x, 1):
+		return "math.Inf(1)"
+	case math.IsInf(x, -1):
+		return "math.Inf(-1)"
+	}
+	return strconv.FormatFloat(x, 'g', -1, bits)
+}
+
+//!+
+
 // formatAtom formats a value without inspecting its internal structure.
 func formatAtom(v reflect.Value) string {
 	switch v.Kind() {
@@ -28,12 +315,16 @@ func formatAtom(v reflect.Value) string {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return strconv.FormatUint(v.Uint(), 10)
-	// ...floating-point and complex cases omitted for brevity...
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
 	case reflect.Bool:
 		return strconv.FormatBool(v.Bool())
 	case reflect.String:
 		return strconv.Quote(v.String())
-	case reflect.Chan, reflect.Func, reflect.Ptr, reflect.Slice, reflect.Map:
+	case reflect.Chan, reflect.Func, reflect.Ptr, reflect.Slice, reflect.Map,
+		reflect.UnsafePointer:
 		return v.Type().String() + " 0x" +
 			strconv.FormatUint(uint64(v.Pointer()), 16)
 	default: // reflect.Array, reflect.Struct, reflect.Interface
@@ -4,7 +4,15 @@
 package format_test
 
 import (
+	"bytes"
 	"fmt"
+	"go/parser"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,13 +20,250 @@ import (
 )
 
 func Test(t *testing.T) {
-	// The pointer values are just examples, and may vary from run to run.
 	//!+time
 	var x int64 = 1
 	var d time.Duration = 1 * time.Nanosecond
 	fmt.Println(format.Any(x))                  // "1"
 	fmt.Println(format.Any(d))                  // "1"
-	fmt.Println(format.Any([]int64{x}))         // "[]int64 0x8202b87b0"
-	fmt.Println(format.Any([]time.Duration{d})) // "[]time.Duration 0x8202b87e0"
+	fmt.Println(format.Any([]int64{x}))         // "[]int64{1}"
+	fmt.Println(format.Any([]time.Duration{d})) // "[]time.Duration{1}"
 	//!-time
 }
+
+type Movie struct {
+	Title, Subtitle string
+	Year            int
+	Color           bool
+	Actor           map[string]string
+	Oscars          []string
+	Sequel          *string
+	Rating          interface{}
+}
+
+var strangelove = Movie{
+	Title:    "Dr. Strangelove",
+	Subtitle: "How I Learned to Stop Worrying and Love the Bomb",
+	Year:     1964,
+	Actor: map[string]string{
+		"Dr. Strangelove": "Peter Sellers",
+		"Gen. Ripper":     "Sterling Hayden",
+	},
+	Oscars: []string{"Best Actor (Nomin.)"},
+	Rating: float32(8.4),
+}
+
+func ExampleAny() {
+	fmt.Println(format.Any(strangelove))
+	// Output:
+	// format_test.Movie{Title: "Dr. Strangelove", Subtitle: "How I Learned to Stop Worrying and Love the Bomb", Year: 1964, Color: false, Actor: map[string]string{"Dr. Strangelove": "Peter Sellers", "Gen. Ripper": "Sterling Hayden"}, Oscars: []string{"Best Actor (Nomin.)"}, Sequel: nil, Rating: 8.4}
+}
+
+func ExampleAny_cycle() {
+	type Link struct {
+		Value int
+		Tail  *Link
+	}
+	l := &Link{Value: 1}
+	l.Tail = &Link{Value: 2, Tail: l}
+	fmt.Println(format.Any(l))
+	// Output:
+	// &format_test.Link{Value: 1, Tail: &format_test.Link{Value: 2, Tail: <cycle>}}
+}
+
+func ExampleGoString() {
+	s, err := format.GoString(strangelove)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(s)
+	// Output:
+	// format_test.Movie{Title: "Dr. Strangelove", Subtitle: "How I Learned to Stop Worrying and Love the Bomb", Year: 1964, Actor: map[string]string{"Dr. Strangelove": "Peter Sellers", "Gen. Ripper": "Sterling Hayden"}, Oscars: []string{"Best Actor (Nomin.)"}, Rating: float32(8.4)}
+}
+
+func TestAny(t *testing.T) {
+	for _, test := range []struct {
+		x    interface{}
+		want string
+	}{
+		{nil, "nil"},
+		{1.5, "1.5"},
+		{float32(0.1), "0.1"},
+		{complex(1, -2), "(1-2i)"},
+		{"hi", `"hi"`},
+		{[2]bool{true}, "[2]bool{true, false}"},
+		{[]interface{}{1, "a", nil}, `[]interface {}{1, "a", nil}`},
+		{map[int]string{2: "b", 1: "a"}, `map[int]string{1: "a", 2: "b"}`},
+		{new(int), "&0"},
+		{(*int)(nil), "nil"},
+		{struct{ X, y int }{1, 2}, "struct { X int; y int }{X: 1, y: 2}"},
+	} {
+		if got := format.Any(test.x); got != test.want {
+			t.Errorf("Any(%#v) = %s, want %s", test.x, got, test.want)
+		}
+	}
+}
+
+type point struct{ X, Y float64 }
+
+// goStringTests pairs values with their GoString.
+var goStringTests = []struct {
+	x    interface{}
+	want string
+}{
+	{nil, "nil"},
+	{1, "1"},
+	{int64(-1), "int64(-1)"},
+	{uint8(255), "uint8(255)"},
+	{time.Second, "time.Duration(1000000000)"},
+	{2.5, "float64(2.5)"},
+	{float32(1e-7), "float32(1e-07)"},
+	{math.Inf(-1), "float64(math.Inf(-1))"},
+	{float32(math.NaN()), "float32(math.NaN())"},
+	{complex(1, 2), "complex128((1+2i))"},
+	{complex(math.Inf(1), 2), "complex128(complex(math.Inf(1), 2))"},
+	{"a\tb", `"a\tb"`},
+	{true, "true"},
+	{[]int(nil), "([]int)(nil)"},
+	{map[string]int(nil), "(map[string]int)(nil)"},
+	{(*int)(nil), "(*int)(nil)"},
+	{(func())(nil), "(func())(nil)"},
+	{[]int{}, "[]int{}"},
+	{[]time.Duration{1, 2}, "[]time.Duration{1, 2}"},
+	{[]interface{}{1, int8(2), 3.0, nil}, "[]interface {}{1, int8(2), float64(3), nil}"},
+	{[]*int{nil}, "[]*int{nil}"},
+	{map[string][]int{"b": nil, "a": {1}}, `map[string][]int{"a": []int{1}, "b": nil}`},
+	{[2]float32{0.5, math.Float32frombits(0x7f800000)}, "[2]float32{0.5, float32(math.Inf(1))}"},
+	{point{X: 1}, "format_test.point{X: 1}"},
+	{&point{Y: -1}, "&format_test.point{Y: -1}"},
+	{&[]point{{}}, "&[]format_test.point{format_test.point{}}"},
+	{[][]string{{"a"}, nil, {}}, `[][]string{[]string{"a"}, nil, []string{}}`},
+	{map[point][]*point{{X: 2}: {nil, {Y: 3}}}, "map[format_test.point][]*format_test.point{" +
+		"format_test.point{X: 2}: []*format_test.point{nil, &format_test.point{Y: 3}}}"},
+	{struct{ P *int }{new(int)}, "struct { P *int }{P: func() *int { var v int = 0; return &v }()}"},
+	{func() **string { s := "x"; p := &s; return &p }(),
+		`func() **string { var v *string = func() *string { var v string = "x"; return &v }(); return &v }()`},
+	{new(interface{}), "func() *interface {} { var v interface {} = nil; return &v }()"},
+}
+
+// TestGoString checks that GoString(x) is the expected source text
+// of x.  TestGoStringEval checks that the text evaluates to x.
+func TestGoString(t *testing.T) {
+	for _, test := range goStringTests {
+		got, err := format.GoString(test.x)
+		if err != nil {
+			t.Errorf("GoString(%#v): %v", test.x, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("GoString(%#v) = %s, want %s", test.x, got, test.want)
+		}
+		if _, err := parser.ParseExpr(got); err != nil {
+			t.Errorf("GoString(%#v) = %s: %v", test.x, got, err)
+		}
+	}
+}
+
+// TestGoStringEval checks that the output of GoString evaluates to
+// the original value, by running a program that evaluates each
+// output and formats the result with Any and GoString.
+func TestGoStringEval(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go run in short mode")
+	}
+	gotool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	// The program must be within this package's directory
+	// to import gopl.io/ch12/format in GOPATH and module modes.
+	dir, err := ioutil.TempDir(".", "_gostring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var prog bytes.Buffer
+	prog.WriteString(`package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gopl.io/ch12/format"
+)
+
+var _, _ = math.Pi, time.Second
+
+type point struct{ X, Y float64 }
+
+func main() {
+	for _, x := range []interface{}{
+`)
+	var want bytes.Buffer
+	for _, test := range goStringTests {
+		// The program declares point in its own package.
+		fmt.Fprintf(&prog, "\t\t%s,\n", strings.ReplaceAll(test.want, "format_test.", ""))
+		fmt.Fprintf(&want, "%s\t%s\n",
+			strings.ReplaceAll(format.Any(test.x), "format_test.", "main."),
+			strings.ReplaceAll(test.want, "format_test.", "main."))
+	}
+	prog.WriteString(`	} {
+		s, err := format.GoString(x)
+		if err != nil {
+			s = err.Error()
+		}
+		fmt.Printf("%s\t%s\n", format.Any(x), s)
+	}
+}
+`)
+	main := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(main, prog.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(gotool, "run", main).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, out, &prog)
+	}
+	gotLines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	wantLines := strings.Split(strings.TrimSuffix(want.String(), "\n"), "\n")
+	if len(gotLines) != len(wantLines) {
+		t.Fatalf("go run printed %d lines, want %d:\n%s", len(gotLines), len(wantLines), out)
+	}
+	for i, test := range goStringTests {
+		if gotLines[i] != wantLines[i] {
+			t.Errorf("%s evaluates to (Any, GoString) %s, want %s",
+				test.want, gotLines[i], wantLines[i])
+		}
+	}
+}
+
+func TestGoStringErrors(t *testing.T) {
+	type link struct{ Tail *link }
+	l := &link{}
+	l.Tail = l
+	s := []interface{}{nil}
+	s[0] = s
+
+	for _, test := range []struct {
+		x    interface{}
+		want string
+	}{
+		{l, "cycle through *format_test.link"},
+		{s, "cycle through []interface {}"},
+		{make(chan int), "cannot express a non-nil chan int"},
+		{[]func(){func() {}}, "cannot express a non-nil func()"},
+	} {
+		_, err := format.GoString(test.x)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("GoString(%T) error = %v, want %q", test.x, err, test.want)
+		}
+	}
+
+	// Shared references are not cycles.
+	p := new(int)
+	if _, err := format.GoString([]*int{p, p}); err != nil {
+		t.Errorf("GoString of shared pointer: %v", err)
+	}
+}
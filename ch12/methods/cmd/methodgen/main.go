@@ -0,0 +1,110 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Methodgen lists the method sets of a type, or generates Go source
+// for an interface, a recording mock and a delegating wrapper with
+// the same methods.  See methods.Generate.
+//
+//	$ methodgen strings.Builder
+//	methods of strings.Builder: none
+//	methods of *strings.Builder:
+//	func (*strings.Builder) Cap() int
+//	...
+//	$ methodgen -pkg fake -interface Reader -mock MockReader io.Reader
+//	$ methodgen -pkg fake -pkgpath ./fake ./store.Store
+//
+// A type is named by the import path of its package, or a relative
+// path to the package's directory, followed by a dot and the type's
+// name.  Methodgen type-checks the package from source, so it can
+// generate code for any type, including those of the user's own
+// packages.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+
+	"gopl.io/ch12/methods"
+)
+
+var (
+	pkg     = flag.String("pkg", "", "generate code in package `name`")
+	pkgPath = flag.String("pkgpath", "", "import `path` of the output package")
+	iface   = flag.String("interface", "", "generate an interface named `name`")
+	mock    = flag.String("mock", "", "generate a recording mock named `name`")
+	wrapper = flag.String("wrapper", "", "generate a delegating wrapper named `name`")
+	value   = flag.Bool("value", false, "use the method set of T, not *T")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: methodgen [flags] package.type\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	t, err := load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "methodgen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *pkg == "" {
+		methods.FprintType(os.Stdout, t)
+		return
+	}
+	opts := methods.Options{
+		Package:   *pkg,
+		PkgPath:   *pkgPath,
+		Interface: *iface,
+		Mock:      *mock,
+		Wrapper:   *wrapper,
+		Value:     *value,
+	}
+	if err := methods.GenerateType(os.Stdout, t, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "methodgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// load type-checks the package named by a qualified type name such
+// as io.Reader or ./store.Store, and returns the named type.
+func load(name string) (types.Type, error) {
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= strings.LastIndexByte(name, '/')+1 {
+		return nil, fmt.Errorf("%s is not of the form package.type", name)
+	}
+	path, typeName := name[:dot], name[dot+1:]
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	// Resolve a relative path to an import path, so that the
+	// generated code imports the package by its proper path.
+	bp, err := build.Import(path, cwd, build.FindOnly)
+	if err != nil {
+		return nil, err
+	}
+	if bp.ImportPath != "." {
+		path = bp.ImportPath
+	}
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	pkg, err := imp.ImportFrom(path, cwd, 0)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("no type %s in package %s", typeName, path)
+	}
+	return obj.Type(), nil
+}
@@ -0,0 +1,422 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package methods
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options controls the declarations that Generate writes.
+// Each declaration is written only if it is named.
+type Options struct {
+	Package   string // name of the output package
+	PkgPath   string // import path of the output package, if any
+	Interface string // name of an interface with the method set
+	Mock      string // name of a recording mock
+	Wrapper   string // name of a delegating wrapper
+	Value     bool   // use the method set of T, not *T
+}
+
+// Generate writes to w a gofmt-formatted Go source file, in package
+// opts.Package, with declarations for the method set of *t (or of t,
+// if opts.Value is set, or if t is an interface):
+//
+// An interface, with one method for each method in the set.
+//
+// A recording mock: a struct type with, for each method M, a field
+// MCalls that records the arguments of each call of M, and a field
+// MFunc that, if non-nil, computes its results; otherwise M returns
+// zero values.  A mutex guards the MCalls fields, so a test that
+// reads them while calls may be in progress must use the method
+// MCallsCopy, which returns a copy of MCalls under the mutex.
+//
+// A delegating wrapper: a struct type that embeds the interface, or,
+// if none is generated, the type itself, and declares each method as
+// a call to the same method of the embedded value.  The methods are
+// a starting point for a wrapper that intercepts some of them.
+//
+// Generate reports an error if a method refers to a type that
+// the output package cannot name.
+func Generate(w io.Writer, t reflect.Type, opts Options) error {
+	if opts.Package == "" {
+		return fmt.Errorf("no output package")
+	}
+	s := SetsOf(t)
+	methods := s.Pointer
+	recv := reflect.PtrTo(s.Type)
+	if opts.Value || s.Type.Kind() == reflect.Interface {
+		methods, recv = s.Value, s.Type
+	}
+	g := newGenerator(opts)
+	var ms []method
+	for _, m := range methods {
+		ft := signature(s.Type, m)
+		gm := method{name: m.Name, variadic: ft.IsVariadic()}
+		for i := 0; i < ft.NumIn(); i++ {
+			gm.params = append(gm.params, g.typeString(ft.In(i)))
+		}
+		for i := 0; i < ft.NumOut(); i++ {
+			gm.results = append(gm.results, g.typeString(ft.Out(i)))
+		}
+		ms = append(ms, gm)
+	}
+	wrapped := opts.Interface
+	if opts.Wrapper != "" && wrapped == "" {
+		wrapped = g.typeString(recv)
+	}
+	g.generate(recv.String(), wrapped, ms, opts)
+	return g.write(w, opts)
+}
+
+var (
+	byteType = reflect.TypeOf(byte(0))
+	runeType = reflect.TypeOf(rune(0))
+)
+
+// A method describes one method of the generated declarations,
+// with its parameter and result types in Go syntax.
+type method struct {
+	name     string
+	params   []string // the last is []T if the method is variadic
+	variadic bool
+	results  []string
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	pkgPath string            // import path of the output package
+	imports map[string]string // maps import path to package name
+	names   map[string]string // maps package name to import path
+	err     error             // first error
+}
+
+func newGenerator(opts Options) *generator {
+	g := &generator{
+		pkgPath: opts.PkgPath,
+		imports: make(map[string]string),
+		names:   make(map[string]string),
+	}
+	if opts.Mock != "" {
+		g.qualify("sync", "sync")
+	}
+	return g
+}
+
+// write writes to w the generated declarations, preceded by the
+// package clause and imports, or reports the first error.
+func (g *generator) write(w io.Writer, opts Options) error {
+	if g.err != nil {
+		return g.err
+	}
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by gopl.io/ch12/methods. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&file, "package %s\n\n", opts.Package)
+	if len(g.imports) > 0 {
+		var paths []string
+		for p := range g.imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		file.WriteString("import (\n")
+		for _, p := range paths {
+			if name := g.imports[p]; name != path.Base(p) {
+				fmt.Fprintf(&file, "%s ", name)
+			}
+			fmt.Fprintf(&file, "%q\n", p)
+		}
+		file.WriteString(")\n\n")
+	}
+	file.Write(g.buf.Bytes())
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate writes the declarations for the methods of recv.
+// The wrapper, if any, embeds the type named by wrapped.
+func (g *generator) generate(recv, wrapped string, methods []method, opts Options) {
+	if opts.Interface != "" {
+		g.printf("// %s is the method set of %s.\n", opts.Interface, recv)
+		g.printf("type %s interface {\n", opts.Interface)
+		for _, m := range methods {
+			g.printf("%s(%s)%s\n", m.name, strings.Join(m.paramTypes(), ", "), m.resultList())
+		}
+		g.printf("}\n\n")
+	}
+
+	if opts.Mock != "" {
+		g.mock(recv, methods, opts)
+	}
+
+	if opts.Wrapper != "" {
+		// The name of an embedded field is that of its type.
+		field := wrapped[strings.LastIndex(wrapped, ".")+1:]
+		field = strings.TrimPrefix(field, "*")
+		g.printf("// %s delegates each method to the embedded %s.\n", opts.Wrapper, field)
+		g.printf("type %s struct {\n%s\n}\n\n", opts.Wrapper, wrapped)
+		if opts.Interface != "" {
+			g.printf("var _ %s = %s{}\n\n", opts.Interface, opts.Wrapper)
+		}
+		for _, m := range methods {
+			g.printf("func (w %s) %s%s {\n", opts.Wrapper, m.name, m.signature())
+			if len(m.results) > 0 {
+				g.printf("return ")
+			}
+			g.printf("w.%s.%s(%s)\n}\n\n", field, m.name, m.args())
+		}
+	}
+}
+
+func (g *generator) mock(recv string, methods []method, opts Options) {
+	g.printf("// %s is a recording implementation of %s.\n", opts.Mock, or(opts.Interface, recv))
+	g.printf("// Each call of a method M is appended to MCalls, then computed\n")
+	g.printf("// by MFunc, if set, or else returns zero values.  MCallsCopy\n")
+	g.printf("// returns a copy of MCalls, and is safe to call while calls of M\n")
+	g.printf("// may be in progress; reading MCalls directly is not.\n")
+	g.printf("type %s struct {\n", opts.Mock)
+	g.printf("mu sync.Mutex // guards the Calls fields\n\n")
+	for _, m := range methods {
+		g.printf("%sFunc func(%s)%s\n", m.name, strings.Join(m.paramTypes(), ", "), m.resultList())
+		g.printf("%sCalls []%s\n", m.name, m.callType())
+	}
+	g.printf("}\n\n")
+	if opts.Interface != "" {
+		g.printf("var _ %s = (*%s)(nil)\n\n", opts.Interface, opts.Mock)
+	}
+
+	for _, m := range methods {
+		g.printf("func (m *%s) %s%s {\n", opts.Mock, m.name, m.signature())
+		g.printf("m.mu.Lock()\n")
+		var fields []string
+		for i := range m.params {
+			fields = append(fields, "a"+strconv.Itoa(i))
+		}
+		g.printf("m.%sCalls = append(m.%[1]sCalls, %s{%s})\n",
+			m.name, m.callType(), strings.Join(fields, ", "))
+		g.printf("m.mu.Unlock()\n")
+		if len(m.results) == 0 {
+			g.printf("if m.%sFunc != nil {\nm.%[1]sFunc(%s)\n}\n}\n\n", m.name, m.args())
+			continue
+		}
+		g.printf("if m.%sFunc != nil {\nreturn m.%[1]sFunc(%s)\n}\n", m.name, m.args())
+		var results []string
+		for i, t := range m.results {
+			r := "r" + strconv.Itoa(i)
+			g.printf("var %s %s\n", r, t)
+			results = append(results, r)
+		}
+		g.printf("return %s\n}\n\n", strings.Join(results, ", "))
+	}
+
+	for _, m := range methods {
+		g.printf("// %sCallsCopy returns a copy of %[1]sCalls.\n", m.name)
+		g.printf("func (m *%s) %sCallsCopy() []%s {\n", opts.Mock, m.name, m.callType())
+		g.printf("m.mu.Lock()\ndefer m.mu.Unlock()\n")
+		g.printf("return append([]%s(nil), m.%sCalls...)\n}\n\n", m.callType(), m.name)
+	}
+}
+
+func or(x, y string) string {
+	if x != "" {
+		return x
+	}
+	return y
+}
+
+// callType returns the struct type that records the arguments
+// of a call of m.
+func (m method) callType() string {
+	var fields []string
+	for i, t := range m.params {
+		fields = append(fields, fmt.Sprintf("A%d %s", i, t))
+	}
+	if len(fields) == 0 {
+		return "struct{}"
+	}
+	return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+}
+
+// paramTypes returns the parameter types of m, with ...T in
+// place of the final []T if m is variadic.
+func (m method) paramTypes() []string {
+	in := append([]string(nil), m.params...)
+	if m.variadic {
+		in[len(in)-1] = "..." + strings.TrimPrefix(in[len(in)-1], "[]")
+	}
+	return in
+}
+
+// signature returns the parameters and results of m,
+// with the parameters named a0, a1, and so on.
+func (m method) signature() string {
+	var in []string
+	for i, t := range m.paramTypes() {
+		in = append(in, fmt.Sprintf("a%d %s", i, t))
+	}
+	return "(" + strings.Join(in, ", ") + ")" + m.resultList()
+}
+
+// args returns the arguments of a call that passes on the
+// parameters named by signature.
+func (m method) args() string {
+	var args []string
+	for i := range m.params {
+		args = append(args, "a"+strconv.Itoa(i))
+	}
+	if m.variadic {
+		args[len(args)-1] += "..."
+	}
+	return strings.Join(args, ", ")
+}
+
+// resultList returns the results of m as they follow
+// the parameters of a signature.
+func (m method) resultList() string {
+	switch len(m.results) {
+	case 0:
+		return ""
+	case 1:
+		return " " + m.results[0]
+	}
+	return " (" + strings.Join(m.results, ", ") + ")"
+}
+
+func (g *generator) results(ft reflect.Type) string {
+	var out []string
+	for i := 0; i < ft.NumOut(); i++ {
+		out = append(out, g.typeString(ft.Out(i)))
+	}
+	return method{results: out}.resultList()
+}
+
+// typeString returns Go syntax for t, qualifying the names of
+// types from other packages and importing those packages.
+// Reflection cannot tell byte from uint8, or rune from int32;
+// typeString uses the aliases, as the standard library does.
+func (g *generator) typeString(t reflect.Type) string {
+	switch t {
+	case byteType:
+		return "byte"
+	case runeType:
+		return "rune"
+	}
+	if t.Name() != "" {
+		if t.PkgPath() == "" || t.PkgPath() == g.pkgPath {
+			return t.Name() // predeclared, or in the output package
+		}
+		if r, _ := utf8.DecodeRuneInString(t.Name()); !unicode.IsUpper(r) {
+			g.errorf("cannot refer to unexported type %s", t)
+			return t.Name()
+		}
+		name := t.String()[:strings.IndexByte(t.String(), '.')]
+		return g.qualify(t.PkgPath(), name) + "." + t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeString(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeString(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.typeString(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", g.typeString(t.Key()), g.typeString(t.Elem()))
+	case reflect.Chan:
+		elem := g.typeString(t.Elem())
+		switch t.ChanDir() {
+		case reflect.RecvDir:
+			return "<-chan " + elem
+		case reflect.SendDir:
+			return "chan<- " + elem
+		}
+		if t.Elem().Kind() == reflect.Chan && t.Elem().ChanDir() == reflect.RecvDir {
+			elem = "(" + elem + ")"
+		}
+		return "chan " + elem
+	case reflect.Func:
+		var in []string
+		for i := 0; i < t.NumIn(); i++ {
+			s := g.typeString(t.In(i))
+			if t.IsVariadic() && i == t.NumIn()-1 {
+				s = "..." + strings.TrimPrefix(s, "[]")
+			}
+			in = append(in, s)
+		}
+		return "func(" + strings.Join(in, ", ") + ")" + g.results(t)
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}"
+		}
+		var methods []string
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			if m.PkgPath != "" {
+				g.errorf("cannot refer to %s with unexported method %s", t, m.Name)
+			}
+			methods = append(methods, m.Name+strings.TrimPrefix(g.typeString(m.Type), "func"))
+		}
+		return "interface {\n" + strings.Join(methods, "\n") + "\n}"
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && f.PkgPath != g.pkgPath {
+				g.errorf("cannot refer to %s with unexported field %s", t, f.Name)
+			}
+			s := g.typeString(f.Type)
+			if !f.Anonymous {
+				s = f.Name + " " + s
+			}
+			if f.Tag != "" {
+				s += " " + strconv.Quote(string(f.Tag))
+			}
+			fields = append(fields, s)
+		}
+		if len(fields) == 0 {
+			return "struct{}"
+		}
+		return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+	}
+	return t.String() // unsafe.Pointer has a name; this is unreachable
+}
+
+// qualify records an import of the package with the given path and
+// name, and returns the name by which the output refers to it.
+// A package whose name is taken by another gets a numbered alias.
+func (g *generator) qualify(pkgPath, name string) string {
+	if n, ok := g.imports[pkgPath]; ok {
+		return n
+	}
+	alias := name
+	for i := 2; g.names[alias] != ""; i++ {
+		alias = name + strconv.Itoa(i)
+	}
+	g.imports[pkgPath] = alias
+	g.names[alias] = pkgPath
+	return alias
+}
+
+func (g *generator) errorf(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = fmt.Errorf(format, args...)
+	}
+}
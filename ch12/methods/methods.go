@@ -3,7 +3,9 @@
 
 // See page 351.
 
-// Package methods provides a function to print the methods of any value.
+// Package methods provides a function to print the methods of any value,
+// and functions to list the method sets of a type and to generate
+// interfaces, mocks and wrappers from them.
 package methods
 
 import (
@@ -4,7 +4,18 @@
 package methods_test
 
 import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"reflect"
 	"strings"
+	"testing"
 	"time"
 
 	"gopl.io/ch12/methods"
@@ -47,3 +58,169 @@ methods.Print(new(strings.Replacer))
 // func (*strings.Replacer) WriteString(io.Writer, string) (int, error)
 //!-output
 */
+
+type counter struct{ n int }
+
+func (c counter) Get() int                   { return c.n }
+func (c *counter) Add(deltas ...int)         {}
+func (c *counter) Load(r io.Reader) error    { return nil }
+func (c *counter) Bytes() (b []byte, r rune) { return }
+
+func ExampleMethodSets_Fprint() {
+	methods.SetsOf(reflect.TypeOf(counter{})).Fprint(os.Stdout)
+	// Output:
+	// methods of methods_test.counter:
+	// func (methods_test.counter) Get() int
+	// methods of *methods_test.counter:
+	// func (*methods_test.counter) Add(...int)
+	// func (*methods_test.counter) Bytes() ([]uint8, int32)
+	// func (*methods_test.counter) Get() int
+	// func (*methods_test.counter) Load(io.Reader) error
+	// only *methods_test.counter: Add Bytes Load
+}
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	opts := methods.Options{
+		Package:   "fake",
+		PkgPath:   "gopl.io/ch12/methods_test",
+		Interface: "Counter",
+		Mock:      "MockCounter",
+		Wrapper:   "CounterWrapper",
+	}
+	if err := methods.Generate(&buf, reflect.TypeOf(counter{}), opts); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.Bytes()
+	if formatted, err := format.Source(src); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	} else if !bytes.Equal(formatted, src) {
+		t.Errorf("generated code is not gofmt-clean:\n%s", src)
+	}
+	for _, want := range []string{
+		"import (\n\t\"io\"\n\t\"sync\"\n)",
+		"\tAdd(...int)\n",
+		"\tBytes() ([]byte, rune)\n",
+		"\tLoad(io.Reader) error\n",
+		"\tAddCalls []struct {\n\t\tA0 []int\n\t}\n",
+		"func (m *MockCounter) Add(a0 ...int) {",
+		"\t\tm.AddFunc(a0...)\n",
+		"var _ Counter = (*MockCounter)(nil)",
+		"func (m *MockCounter) LoadCallsCopy() []struct {\n\tA0 io.Reader\n} {\n" +
+			"\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n",
+		"func (m *MockCounter) GetCallsCopy() []struct{} {",
+		"type CounterWrapper struct {\n\tCounter\n}",
+		"\treturn w.Counter.Load(a0)\n",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+
+	// Only the pointer method set has Add.
+	buf.Reset()
+	opts.Value = true
+	if err := methods.Generate(&buf, reflect.TypeOf(counter{}), opts); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Add") {
+		t.Errorf("method set of T includes Add:\n%s", &buf)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, test := range []struct {
+		opts methods.Options
+		want string
+	}{
+		{methods.Options{Interface: "I"}, "no output package"},
+		{methods.Options{Package: "other", Interface: "I"}, "cannot refer to unexported type"},
+	} {
+		err := methods.Generate(io.Discard, reflect.TypeOf(new(uses)), test.opts)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Generate(%+v) = %v, want error containing %q", test.opts, err, test.want)
+		}
+	}
+}
+
+type uses struct{}
+
+func (uses) Count(c counter) {}
+
+// counterSrc declares counter and uses, as above.
+const counterSrc = `package methods_test
+
+import "io"
+
+type counter struct{ n int }
+
+func (c counter) Get() int                   { return c.n }
+func (c *counter) Add(deltas ...int)         {}
+func (c *counter) Load(r io.Reader) error    { return nil }
+func (c *counter) Bytes() (b []byte, r rune) { return }
+
+type uses struct{}
+
+func (uses) Count(c counter) {}
+`
+
+// check type-checks counterSrc and returns its package.
+func check(t *testing.T) *types.Package {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "counter.go", counterSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("gopl.io/ch12/methods_test", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestGenerateType(t *testing.T) {
+	counterType := check(t).Scope().Lookup("counter").Type()
+	for _, opts := range []methods.Options{
+		{Package: "fake", PkgPath: "gopl.io/ch12/methods_test",
+			Interface: "Counter", Mock: "MockCounter", Wrapper: "CounterWrapper"},
+		{Package: "fake", Mock: "MockCounter", Wrapper: "CounterWrapper"},
+		{Package: "fake", Wrapper: "CounterWrapper", Value: true},
+	} {
+		var want, got bytes.Buffer
+		wantErr := methods.Generate(&want, reflect.TypeOf(counter{}), opts)
+		gotErr := methods.GenerateType(&got, counterType, opts)
+		if (gotErr == nil) != (wantErr == nil) || got.String() != want.String() {
+			t.Errorf("GenerateType(%+v) = %v\n%s\nGenerate = %v\n%s",
+				opts, gotErr, &got, wantErr, &want)
+		}
+	}
+}
+
+func TestGenerateTypeErrors(t *testing.T) {
+	usesType := check(t).Scope().Lookup("uses").Type()
+	for _, test := range []struct {
+		opts methods.Options
+		want string
+	}{
+		{methods.Options{Interface: "I"}, "no output package"},
+		{methods.Options{Package: "other", Interface: "I"}, "cannot refer to unexported type"},
+	} {
+		err := methods.GenerateType(io.Discard, usesType, test.opts)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("GenerateType(%+v) = %v, want error containing %q", test.opts, err, test.want)
+		}
+	}
+}
+
+func ExampleFprintType() {
+	pkg, err := importer.ForCompiler(token.NewFileSet(), "source", nil).Import("io")
+	if err != nil {
+		panic(err)
+	}
+	methods.FprintType(os.Stdout, pkg.Scope().Lookup("ReadWriter").Type())
+	// Output:
+	// methods of io.ReadWriter:
+	// func (io.ReadWriter) Read(p []byte) (n int, err error)
+	// func (io.ReadWriter) Write(p []byte) (n int, err error)
+}
@@ -0,0 +1,108 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package methods
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// MethodSets holds the method sets of a type T and of its pointer
+// type *T.  The method set of *T includes that of T, and adds the
+// methods declared with pointer receivers.
+type MethodSets struct {
+	Type    reflect.Type     // T
+	Value   []reflect.Method // the method set of T
+	Pointer []reflect.Method // the method set of *T
+}
+
+// SetsOf returns the method sets of t, or, if t is an unnamed pointer
+// to a named type, of the type it points to.  The pointer method set
+// of an interface type is empty.
+func SetsOf(t reflect.Type) MethodSets {
+	if t.Kind() == reflect.Ptr && t.Name() == "" && t.Elem().Name() != "" {
+		t = t.Elem()
+	}
+	s := MethodSets{Type: t, Value: methodsOf(t)}
+	if t.Kind() != reflect.Interface {
+		s.Pointer = methodsOf(reflect.PtrTo(t))
+	}
+	return s
+}
+
+func methodsOf(t reflect.Type) []reflect.Method {
+	var methods []reflect.Method
+	for i := 0; i < t.NumMethod(); i++ {
+		methods = append(methods, t.Method(i))
+	}
+	return methods
+}
+
+// PointerOnly returns the methods of *T that T lacks.
+func (s MethodSets) PointerOnly() []reflect.Method {
+	var methods []reflect.Method
+	for _, m := range s.Pointer {
+		if _, ok := s.Type.MethodByName(m.Name); !ok {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// Fprint writes the method sets to w, in the style of Print,
+// followed by their difference:
+//
+//	methods of strings.Builder: none
+//	methods of *strings.Builder:
+//	func (*strings.Builder) Cap() int
+//	...
+//	only *strings.Builder: Cap Grow Len Reset String Write ...
+func (s MethodSets) Fprint(w io.Writer) {
+	section := func(recv string, methods []reflect.Method) {
+		if len(methods) == 0 {
+			fmt.Fprintf(w, "methods of %s: none\n", recv)
+			return
+		}
+		fmt.Fprintf(w, "methods of %s:\n", recv)
+		for _, m := range methods {
+			fmt.Fprintf(w, "func (%s) %s%s\n", recv, m.Name,
+				strings.TrimPrefix(signature(s.Type, m).String(), "func"))
+		}
+	}
+	section(s.Type.String(), s.Value)
+	if s.Type.Kind() == reflect.Interface {
+		return
+	}
+	ptr := "*" + s.Type.String()
+	section(ptr, s.Pointer)
+	fmt.Fprintf(w, "only %s:", ptr)
+	only := s.PointerOnly()
+	if len(only) == 0 {
+		fmt.Fprint(w, " none")
+	}
+	for _, m := range only {
+		fmt.Fprintf(w, " %s", m.Name)
+	}
+	fmt.Fprintln(w)
+}
+
+// signature returns the type of method m of t (or *t),
+// without its receiver.
+func signature(t reflect.Type, m reflect.Method) reflect.Type {
+	if t.Kind() == reflect.Interface {
+		return m.Type // no receiver
+	}
+	ft := m.Type
+	in := make([]reflect.Type, ft.NumIn()-1)
+	for i := range in {
+		in[i] = ft.In(i + 1)
+	}
+	out := make([]reflect.Type, ft.NumOut())
+	for i := range out {
+		out[i] = ft.Out(i)
+	}
+	return reflect.FuncOf(in, out, ft.IsVariadic())
+}
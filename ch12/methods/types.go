@@ -0,0 +1,189 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package methods
+
+import (
+	"fmt"
+	"go/types"
+	"io"
+	"strings"
+)
+
+// This file provides the functions of sets.go and generate.go for
+// types described by go/types, such as those of a package loaded from
+// source, which need not be linked into the program that inspects them.
+
+// TypeSets returns the method sets of the named type t, or of the
+// named type to which t points.  The pointer method set of an
+// interface type is nil.
+func TypeSets(t types.Type) (value, pointer *types.MethodSet) {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	value = types.NewMethodSet(t)
+	if types.IsInterface(t) {
+		return value, nil
+	}
+	return value, types.NewMethodSet(types.NewPointer(t))
+}
+
+// FprintType writes the method sets of t to w, in the format of
+// MethodSets.Fprint, with types qualified by package name.
+func FprintType(w io.Writer, t types.Type) {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	value, pointer := TypeSets(t)
+	qual := (*types.Package).Name
+	section := func(recv string, mset *types.MethodSet) {
+		methods := exported(t, mset)
+		if len(methods) == 0 {
+			fmt.Fprintf(w, "methods of %s: none\n", recv)
+			return
+		}
+		fmt.Fprintf(w, "methods of %s:\n", recv)
+		for _, m := range methods {
+			fmt.Fprintf(w, "func (%s) %s%s\n", recv, m.Name(),
+				strings.TrimPrefix(types.TypeString(m.Type(), qual), "func"))
+		}
+	}
+	section(types.TypeString(t, qual), value)
+	if types.IsInterface(t) {
+		return
+	}
+	ptr := "*" + types.TypeString(t, qual)
+	section(ptr, pointer)
+	fmt.Fprintf(w, "only %s:", ptr)
+	n := 0
+	for _, m := range exported(t, pointer) {
+		if value.Lookup(m.Pkg(), m.Name()) == nil {
+			fmt.Fprintf(w, " %s", m.Name())
+			n++
+		}
+	}
+	if n == 0 {
+		fmt.Fprint(w, " none")
+	}
+	fmt.Fprintln(w)
+}
+
+// exported returns the methods of mset, a method set of t,
+// omitting unexported methods unless t is an interface.
+func exported(t types.Type, mset *types.MethodSet) []*types.Func {
+	var methods []*types.Func
+	for i := 0; i < mset.Len(); i++ {
+		m := mset.At(i).Obj().(*types.Func)
+		if m.Exported() || types.IsInterface(t) {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// GenerateType is like Generate, but for the type t described by
+// go/types.
+func GenerateType(w io.Writer, t types.Type, opts Options) error {
+	if opts.Package == "" {
+		return fmt.Errorf("no output package")
+	}
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok && named.TypeParams().Len() > 0 {
+		return fmt.Errorf("cannot generate methods of generic type %s", t)
+	}
+	value, pointer := TypeSets(t)
+	mset, recv := pointer, types.Type(types.NewPointer(t))
+	if opts.Value || types.IsInterface(t) {
+		mset, recv = value, t
+	}
+	g := newGenerator(opts)
+	var ms []method
+	for _, m := range exported(t, mset) {
+		sig := m.Type().(*types.Signature)
+		gm := method{name: m.Name(), variadic: sig.Variadic()}
+		for i := 0; i < sig.Params().Len(); i++ {
+			gm.params = append(gm.params, g.goTypeString(sig.Params().At(i).Type()))
+		}
+		for i := 0; i < sig.Results().Len(); i++ {
+			gm.results = append(gm.results, g.goTypeString(sig.Results().At(i).Type()))
+		}
+		ms = append(ms, gm)
+	}
+	wrapped := opts.Interface
+	if opts.Wrapper != "" && wrapped == "" {
+		wrapped = g.goTypeString(recv)
+	}
+	g.generate(types.TypeString(recv, (*types.Package).Name), wrapped, ms, opts)
+	return g.write(w, opts)
+}
+
+// goTypeString is the analogue of typeString for go/types.
+func (g *generator) goTypeString(t types.Type) string {
+	g.checkType(t, make(map[types.Type]bool))
+	return types.TypeString(t, func(p *types.Package) string {
+		if p.Path() == g.pkgPath {
+			return ""
+		}
+		return g.qualify(p.Path(), p.Name())
+	})
+}
+
+// checkType reports an error if t refers to an unexported type,
+// field or method of a package other than the output package.
+func (g *generator) checkType(t types.Type, seen map[types.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	foreign := func(obj types.Object) bool {
+		return !obj.Exported() && obj.Pkg() != nil && obj.Pkg().Path() != g.pkgPath
+	}
+	switch t := t.(type) {
+	case *types.Named:
+		if foreign(t.Obj()) {
+			g.errorf("cannot refer to unexported type %s", t)
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			g.checkType(t.TypeArgs().At(i), seen)
+		}
+	case *types.Alias:
+		if foreign(t.Obj()) {
+			g.errorf("cannot refer to unexported type %s", t)
+		}
+	case *types.Pointer:
+		g.checkType(t.Elem(), seen)
+	case *types.Slice:
+		g.checkType(t.Elem(), seen)
+	case *types.Array:
+		g.checkType(t.Elem(), seen)
+	case *types.Chan:
+		g.checkType(t.Elem(), seen)
+	case *types.Map:
+		g.checkType(t.Key(), seen)
+		g.checkType(t.Elem(), seen)
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				g.checkType(tuple.At(i).Type(), seen)
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			f := t.Field(i)
+			if foreign(f) {
+				g.errorf("cannot refer to %s with unexported field %s", t, f.Name())
+			}
+			g.checkType(f.Type(), seen)
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			m := t.Method(i)
+			if foreign(m) {
+				g.errorf("cannot refer to %s with unexported method %s", t, m.Name())
+			}
+			g.checkType(m.Type(), seen)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Pack returns the parameters that Unpack would decode into a copy of
+// the struct pointed to by ptr.  Fields are named as by Unpack; a slice
+// field yields a repeated parameter, and a map field m a parameter
+// "m[key]" for each entry.  Fields taken only from the path, cookies
+// or headers, and files, are left out; so are nil pointers and slices,
+// and zero values of fields whose tag has the omitempty option:
+//
+//	Labels []string `http:"l,omitempty"`
+//
+// Values round-trip through Unpack except that an empty slice or map
+// is decoded as nil, times are decoded in a fixed zone, and a zero
+// value not left out overwrites any default set before Unpack.
+func Pack(ptr interface{}) (url.Values, error) {
+	v := reflect.ValueOf(ptr).Elem() // the struct variable
+	params := make(url.Values)
+	for _, f := range structFields(v.Type()) {
+		if sourceOnly(f) || isFile(f.typ) {
+			continue
+		}
+		fv, ok := lookupField(v, f.index)
+		if !ok {
+			continue // within a nil struct pointer
+		}
+		if f.omitempty && isEmpty(fv) {
+			continue
+		}
+		if err := packParam(params, f.name, fv); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+	}
+	return params, nil
+}
+
+// URL returns base with the parameters packed from the struct pointed
+// to by ptr added to its query, replacing any of the same names.
+func URL(base string, ptr interface{}) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	params, err := Pack(ptr)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// packParam adds to params the values of field v, whose name is name.
+func packParam(params url.Values, name string, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.Map:
+		keys := v.MapKeys()
+		texts := make([]string, len(keys))
+		for i, k := range keys {
+			text, err := formatParam(k)
+			if err != nil {
+				return err
+			}
+			texts[i] = text
+		}
+		sort.Sort(byText{keys, texts})
+		for i, k := range keys {
+			if err := packParam(params, name+"["+texts[i]+"]", v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+
+	case v.Kind() == reflect.Slice && !isLeaf(v.Type()):
+		for i := 0; i < v.Len(); i++ {
+			if err := packParam(params, name, v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case v.Kind() == reflect.Ptr && v.IsNil():
+		// left out
+
+	default:
+		text, err := formatParam(v)
+		if err != nil {
+			return err
+		}
+		params.Add(name, text)
+	}
+	return nil
+}
+
+// byText sorts map keys by their text.
+type byText struct {
+	keys  []reflect.Value
+	texts []string
+}
+
+func (b byText) Len() int           { return len(b.keys) }
+func (b byText) Less(i, j int) bool { return b.texts[i] < b.texts[j] }
+func (b byText) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.texts[i], b.texts[j] = b.texts[j], b.texts[i]
+}
+
+// formatParam returns the text of v that populate parses.
+func formatParam(v reflect.Value) (string, error) {
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case durationType:
+		return time.Duration(v.Int()).String(), nil
+	}
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok && v.CanAddr() {
+		m, ok = v.Addr().Interface().(encoding.TextMarshaler)
+	}
+	if ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Ptr:
+		return formatParam(v.Elem())
+	}
+	return "", fmt.Errorf("unsupported kind %s", v.Type())
+}
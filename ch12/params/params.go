@@ -4,76 +4,262 @@
 // See page 349.
 
 // Package params provides a reflection-based parser for URL parameters.
+//
+// Each exported field of a struct is named by its http tag, or by its
+// name in lower case.  The tag may also have options after the name,
+// as in http:"max,omitempty" or http:",omitempty"; see Pack.
+// Fields of a nested struct, or of a pointer to one, are named with a
+// dotted prefix, as in "addr.city", except that those of an embedded
+// struct are promoted.  A struct nested within itself is not expanded.
+// A field tagged http:"-" is ignored.  A map field named "m" is
+// populated from parameters of the form "m[key]".
+//
+// Fields may be of any boolean, numeric or string type, time.Duration,
+// time.Time (in RFC 3339 or YYYY-MM-DD form), any type whose pointer
+// implements encoding.TextUnmarshaler, or a pointer to or slice of any
+// of these.  A slice field accumulates repeated parameters; any other
+// field takes the last one.
+//
+// # Sources
+//
+// Unpack takes parameters from these sources, in increasing order of
+// precedence:
+//
+//  1. a JSON body, if the Content-Type is application/json
+//  2. the URL query
+//  3. a form body, urlencoded or multipart
+//  4. the path, for fields tagged path:"name"
+//  5. cookies, for fields tagged cookie:"name"
+//  6. headers, for fields tagged header:"X-Name"
+//
+// A field takes its value from the highest-precedence source that
+// supplies it, so a slice field never mixes values from two sources.
+// A JSON body is decoded by encoding/json, so its names are those of
+// json tags.  A field of type *multipart.FileHeader or a slice of them
+// holds the files of that name in a multipart body.  A field tagged
+// path, cookie or header is not taken from the other sources unless it
+// also has an http tag, so that, for example, a header that a proxy
+// sets cannot be forged by a query parameter.
+//
+// The path:"name" tag selects the wildcard {name} of the pattern given
+// to UnpackRoute, or, for Unpack, of the request's http.ServeMux pattern.
 package params
 
 import (
+	"encoding"
 	"fmt"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-//!+Unpack
-
 // Unpack populates the fields of the struct pointed to by ptr
-// from the HTTP request parameters in req.
+// from the HTTP request parameters in req, then checks them as
+// Validate does.  If any are invalid, it returns an Errors.
 func Unpack(req *http.Request, ptr interface{}) error {
-	if err := req.ParseForm(); err != nil {
+	return unpack(req, ptr, func(name string) []string {
+		if value := req.PathValue(name); value != "" {
+			return []string{value}
+		}
+		return nil
+	})
+}
+
+//!+Unpack
+
+// unpack is the implementation of Unpack and UnpackRoute.
+// pathValues returns the values of a path wildcard.
+func unpack(req *http.Request, ptr interface{}, pathValues func(string) []string) error {
+	if err := parseBody(req); err != nil {
 		return err
 	}
 
 	// Build map of fields keyed by effective name.
-	fields := make(map[string]reflect.Value)
 	v := reflect.ValueOf(ptr).Elem() // the struct variable
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i) // a reflect.StructField
-		tag := fieldInfo.Tag           // a reflect.StructTag
-		name := tag.Get("http")
-		if name == "" {
-			name = strings.ToLower(fieldInfo.Name)
-		}
-		fields[name] = v.Field(i)
-	}
-
-	// Update struct field for each parameter in the request.
-	for name, values := range req.Form {
-		f := fields[name]
-		if !f.IsValid() {
-			continue // ignore unrecognized HTTP parameters
-		}
-		for _, value := range values {
-			if f.Kind() == reflect.Slice {
-				elem := reflect.New(f.Type().Elem()).Elem()
-				if err := populate(elem, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
-				}
-				f.Set(reflect.Append(f, elem))
-			} else {
-				if err := populate(f, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
+	all := structFields(v.Type())
+	fields := make(map[string]fieldInfo)
+	for _, f := range all {
+		if !sourceOnly(f) {
+			fields[f.name] = f
+		}
+	}
+
+	if err := decodeJSON(req, v, all); err != nil {
+		return err
+	}
+
+	// Update struct field for each parameter in the request,
+	// and for each file.
+	errs := make(Errors)
+	for _, form := range []map[string][]string{req.URL.Query(), req.PostForm} {
+		for name, values := range form {
+			if err := unpackParam(v, fields, name, values); err != nil {
+				errs[name] = err
+			}
+		}
+	}
+	if req.MultipartForm != nil {
+		unpackFiles(v, fields, req.MultipartForm.File)
+	}
+
+	// Update tagged fields from the path, cookies and headers.
+	for _, f := range all {
+		for _, src := range sources {
+			key, ok := f.tag.Lookup(src.tag)
+			if !ok {
+				continue
+			}
+			if values := src.values(req, key, pathValues); len(values) > 0 {
+				if err := populateAll(fieldByIndex(v, f.index), values); err != nil {
+					errs[f.name] = err
 				}
 			}
 		}
 	}
+
+	validate(v, errs)
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
 //!-Unpack
 
+// Errors maps the names of invalid parameters to their errors.
+type Errors map[string]error
+
+func (errs Errors) Error() string {
+	var names []string
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s: %v", name, errs[name])
+	}
+	return b.String()
+}
+
+// unpackParam updates the field of the struct v named by the
+// parameter name, or the map entry if name has the form "m[key]".
+// It ignores unrecognized parameters.
+func unpackParam(v reflect.Value, fields map[string]fieldInfo, name string, values []string) error {
+	key, isEntry := "", false
+	if i := strings.IndexByte(name, '['); i > 0 && strings.HasSuffix(name, "]") {
+		name, key, isEntry = name[:i], name[i+1:len(name)-1], true
+	}
+	info, ok := fields[name]
+	if !ok || isEntry != (info.typ.Kind() == reflect.Map) {
+		return nil
+	}
+	if isFile(info.typ) {
+		return nil // see unpackFiles
+	}
+	f := fieldByIndex(v, info.index)
+	if !isEntry {
+		return populateAll(f, values)
+	}
+
+	k := reflect.New(f.Type().Key()).Elem()
+	if err := populate(k, key); err != nil {
+		return err
+	}
+	elem := reflect.New(f.Type().Elem()).Elem()
+	if f.IsNil() {
+		f.Set(reflect.MakeMap(f.Type()))
+	}
+	if err := populateAll(elem, values); err != nil {
+		return err
+	}
+	f.SetMapIndex(k, elem)
+	return nil
+}
+
+// populateAll populates v from the values of a repeated parameter,
+// replacing those of any other source.
+func populateAll(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.Zero(v.Type()))
+	}
+	for _, value := range values {
+		if v.Kind() == reflect.Slice && !isLeaf(v.Type()) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := populate(elem, value); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		} else {
+			if err := populate(v, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
 //!+populate
 func populate(v reflect.Value, value string) error {
+	switch v.Type() {
+	case timeType:
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
 	switch v.Kind() {
 	case reflect.String:
 		v.SetString(value)
 
-	case reflect.Int:
-		i, err := strconv.ParseInt(value, 10, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
 		if err != nil {
 			return err
 		}
 		v.SetInt(i)
 
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
@@ -81,6 +267,13 @@ func populate(v reflect.Value, value string) error {
 		}
 		v.SetBool(b)
 
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := populate(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+
 	default:
 		return fmt.Errorf("unsupported kind %s", v.Type())
 	}
@@ -88,3 +281,107 @@ func populate(v reflect.Value, value string) error {
 }
 
 //!-populate
+
+// parseTime parses a time in RFC 3339 form, or a date.
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or YYYY-MM-DD", value)
+}
+
+// A fieldInfo describes a field that holds a parameter.
+type fieldInfo struct {
+	name      string // effective name, with a dotted prefix if nested
+	index     []int  // index sequence for fieldByIndex
+	typ       reflect.Type
+	tag       reflect.StructTag
+	omitempty bool // Pack omits a zero value
+}
+
+// structFields returns the parameter fields of the struct type t,
+// in depth-first order.
+func structFields(t reflect.Type) []fieldInfo {
+	var fields []fieldInfo
+	visiting := make(map[reflect.Type]bool) // breaks recursive types
+	var walk func(t reflect.Type, prefix string, index []int)
+	walk = func(t reflect.Type, prefix string, index []int) {
+		if visiting[t] {
+			return
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tagName, opts := f.Tag.Get("http"), ""
+			if i := strings.IndexByte(tagName, ','); i >= 0 {
+				tagName, opts = tagName[:i], tagName[i:]
+			}
+			if tagName == "-" {
+				continue
+			}
+			name := tagName
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			index := append(index[:len(index):len(index)], i)
+			if st := structType(f.Type); st != nil {
+				switch {
+				case f.Anonymous && tagName == "":
+					// Promote the fields of an embedded struct, unless
+					// it is unexported and would need allocating.
+					if f.PkgPath == "" || f.Type.Kind() == reflect.Struct {
+						walk(st, prefix, index)
+					}
+				case f.PkgPath == "":
+					walk(st, prefix+name+".", index)
+				}
+				continue
+			}
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+			omitempty := strings.Contains(opts+",", ",omitempty,")
+			fields = append(fields, fieldInfo{prefix + name, index, f.Type, f.Tag, omitempty})
+		}
+	}
+	walk(t, "", nil)
+	return fields
+}
+
+// structType returns the struct type of a nested struct field
+// of type t, or nil if t holds a single parameter.
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isLeaf(t) {
+		return nil
+	}
+	return t
+}
+
+// isLeaf reports whether a value of type t, though it may be a struct
+// or slice, is parsed from a single parameter.
+func isLeaf(t reflect.Type) bool {
+	return t == timeType || t == fileHeaderType ||
+		reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// fieldByIndex returns the nested field of the struct v with the
+// given index sequence, allocating nil struct pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
@@ -0,0 +1,314 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Address struct {
+	City string
+	Zip  uint16 `http:"postcode"`
+}
+
+type Paging struct {
+	Page  int
+	Limit int8
+}
+
+type Query struct {
+	Paging
+	Labels  []string `http:"l"`
+	Max     int      `http:"max"`
+	Exact   bool     `http:"x"`
+	Score   float64
+	Ratio   *float32
+	Since   time.Time
+	Timeout time.Duration
+	IP      net.IP
+	Home    Address `http:"addr"`
+	Work    *Address
+	Tags    map[string]int
+	Secret  string `http:"-"`
+	hidden  string
+}
+
+func TestUnpack(t *testing.T) {
+	req := httptest.NewRequest("GET", "/search?"+
+		"l=golang&l=programming&max=100&x=true&page=2&limit=-3&"+
+		"score=1.5e3&ratio=0.25&since=2016-10-26&timeout=1m30s&ip=10.0.0.1&"+
+		"addr.city=Boston&addr.postcode=02134&work.city=Cambridge&"+
+		"tags[a]=1&tags[b]=2&secret=x&hidden=y&unknown=z&tags=9", nil)
+	var got Query
+	got.Max = 10 // default
+	if err := Unpack(req, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	ratio := float32(0.25)
+	want := Query{
+		Paging:  Paging{Page: 2, Limit: -3},
+		Labels:  []string{"golang", "programming"},
+		Max:     100,
+		Exact:   true,
+		Score:   1500,
+		Ratio:   &ratio,
+		Since:   time.Date(2016, 10, 26, 0, 0, 0, 0, time.UTC),
+		Timeout: 90 * time.Second,
+		IP:      net.ParseIP("10.0.0.1"),
+		Home:    Address{City: "Boston", Zip: 2134},
+		Work:    &Address{City: "Cambridge"},
+		Tags:    map[string]int{"a": 1, "b": 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unpack = %+v,\nwant %+v", got, want)
+	}
+}
+
+func TestUnpackTime(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?since=2016-10-26T15:04:05.5-04:00", nil)
+	var data struct{ Since *time.Time }
+	if err := Unpack(req, &data); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2016, 10, 26, 19, 4, 5, 5e8, time.UTC)
+	if data.Since == nil || !data.Since.Equal(want) {
+		t.Errorf("Since = %v, want %v", data.Since, want)
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?"+
+		"max=lots&x=123&limit=300&tags[a]=one&postcode=-1&since=yesterday&l=ok", nil)
+	var data struct {
+		Labels   []string `http:"l"`
+		Max      int      `http:"max"`
+		Exact    bool     `http:"x"`
+		Limit    int8
+		Tags     map[string]int
+		Postcode uint
+		Since    time.Time
+	}
+	err := Unpack(req, &data)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Unpack returned %v, want Errors", err)
+	}
+	for _, name := range []string{"max", "x", "limit", "tags[a]", "postcode", "since"} {
+		if errs[name] == nil {
+			t.Errorf("no error for %s", name)
+		}
+	}
+	if len(errs) != 6 {
+		t.Errorf("got %d errors, want 6: %v", len(errs), err)
+	}
+	if got := fmt.Sprint(errs["max"]); got != `strconv.ParseInt: parsing "lots": invalid syntax` {
+		t.Errorf("max error = %s", got)
+	}
+	if data.Labels[0] != "ok" {
+		t.Errorf("valid parameter l was not unpacked despite other errors")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	errs := Errors{
+		"x":   fmt.Errorf("bad"),
+		"max": fmt.Errorf("too big"),
+	}
+	if got, want := errs.Error(), "max: too big; x: bad"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestRecursiveType(t *testing.T) {
+	// A struct nested within itself is not expanded.
+	type Node struct {
+		Name string
+		Next *Node
+	}
+	req := httptest.NewRequest("GET", "/?name=a&next.name=b", nil)
+	var n Node
+	if err := Unpack(req, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Name != "a" || n.Next != nil {
+		t.Errorf("Unpack = %+v", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type Contact struct {
+		Email string `validate:"required,email"`
+	}
+	type Form struct {
+		Max     int           `http:"max" validate:"min=1,max=100"`
+		Ratio   float64       `validate:"max=0.5"`
+		Count   uint          `validate:"max=2"`
+		Name    string        `validate:"required,min=2,max=5"`
+		Sort    string        `validate:"oneof=asc|desc"`
+		Code    string        `validate:"len=3,regexp=^[A-Z]{2,3}$"`
+		Labels  []string      `http:"l" validate:"max=2,oneof=go|c|rust"`
+		Wait    time.Duration `validate:"max=1m"`
+		Page    *int          `validate:"min=1"`
+		Email   string        `validate:"email"`
+		Contact *Contact
+		Home    Contact
+	}
+
+	for _, test := range []struct {
+		query string
+		want  map[string]string
+	}{
+		{"max=10&name=Gopher&sort=asc&code=ABC&l=go&l=c&wait=2s&page=1&email=a@b.org&home.email=x@y.z",
+			map[string]string{"name": "length must be at most 5"}},
+		{"max=0&name=é&count=3&ratio=0.75&sort=up&code=AB&l=go&l=c&l=rust&wait=1h&page=0&email=Me+<a@b.org>&home.email=x@y.z",
+			map[string]string{
+				"max":   "must be at least 1",
+				"name":  "length must be at least 2",
+				"count": "must be at most 2",
+				"ratio": "must be at most 0.5",
+				"sort":  "must be one of asc, desc",
+				"code":  "length must be 3",
+				"l":     "length must be at most 2",
+				"wait":  "must be at most 1m",
+				"page":  "must be at least 1",
+				"email": "must be an email address",
+			}},
+		{"max=1&name=Bob&code=abc&l=java&contact.email=&home.email=nope",
+			map[string]string{
+				"code":          "must match ^[A-Z]{2,3}$",
+				"l":             "must be one of go, c, rust",
+				"contact.email": "is required",
+				"home.email":    "must be an email address",
+			}},
+		{"max=x&name=Bob&home.email=a@b.c",
+			map[string]string{"max": `strconv.ParseInt: parsing "x": invalid syntax`}},
+		{"", map[string]string{
+			"max":        "must be at least 1",
+			"name":       "is required",
+			"home.email": "is required",
+		}},
+	} {
+		var form Form
+		err := Unpack(httptest.NewRequest("GET", "/?"+test.query, nil), &form)
+		got := make(map[string]string)
+		if errs, ok := err.(Errors); ok {
+			for name, err := range errs {
+				got[name] = err.Error()
+			}
+		} else if err != nil {
+			t.Errorf("%s: Unpack returned %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got errors\n%v, want\n%v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestValidateBadTag(t *testing.T) {
+	for _, tag := range []string{
+		"between=1", "min", "required=yes", "regexp=(", "len=x",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("tag %q: no panic", tag)
+				}
+			}()
+			check(reflect.ValueOf(1), parseRules(tag))
+		}()
+	}
+}
+
+func TestPack(t *testing.T) {
+	ratio := float32(0.25)
+	q := Query{
+		Paging:  Paging{Page: 2, Limit: -3},
+		Labels:  []string{"golang", "programming"},
+		Max:     100,
+		Exact:   true,
+		Score:   1500,
+		Ratio:   &ratio,
+		Since:   time.Date(2016, 10, 26, 15, 4, 5, 5e8, time.UTC),
+		Timeout: 90 * time.Second,
+		IP:      net.ParseIP("10.0.0.1"),
+		Home:    Address{City: "Boston", Zip: 2134},
+		Tags:    map[string]int{"b": 2, "a": 1},
+		Secret:  "x",
+	}
+	params, err := Pack(&q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "addr.city=Boston&addr.postcode=2134&ip=10.0.0.1&" +
+		"l=golang&l=programming&limit=-3&max=100&page=2&ratio=0.25&" +
+		"score=1500&since=2016-10-26T15%3A04%3A05.5Z&" +
+		"tags%5Ba%5D=1&tags%5Bb%5D=2&timeout=1m30s&x=true"
+	if got := params.Encode(); got != want {
+		t.Errorf("Pack = %s,\nwant %s", got, want)
+	}
+
+	// Unpack decodes it back to an equal struct, except for Secret.
+	var got Query
+	req := httptest.NewRequest("GET", "/?"+params.Encode(), nil)
+	if err := Unpack(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	q.Secret = ""
+	if !reflect.DeepEqual(got, q) {
+		t.Errorf("Unpack(Pack(q)) = %+v,\nwant %+v", got, q)
+	}
+}
+
+func TestPackOmitEmpty(t *testing.T) {
+	type Search struct {
+		Labels     []string `http:"l,omitempty"`
+		MaxResults int      `http:"max,omitempty"`
+		Exact      bool     `http:"x"`
+		Offset     int      `http:",omitempty"`
+		Sort       *string  `http:"sort"`
+	}
+	for _, test := range []struct {
+		s    Search
+		want string
+	}{
+		{Search{}, "x=false"},
+		{Search{Labels: []string{}, MaxResults: 10, Offset: 5}, "max=10&offset=5&x=false"},
+		{Search{Labels: []string{"a b", "c&d"}, Exact: true}, "l=a+b&l=c%26d&x=true"},
+	} {
+		params, err := Pack(&test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := params.Encode(); got != test.want {
+			t.Errorf("Pack(%+v) = %s, want %s", test.s, got, test.want)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	data := struct {
+		Labels []string `http:"l"`
+		Max    int      `http:"max"`
+	}{[]string{"go"}, 20}
+	got, err := URL("http://localhost:12345/search?max=10&lang=en#top", &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "http://localhost:12345/search?l=go&lang=en&max=20#top"
+	if got != want {
+		t.Errorf("URL = %s, want %s", got, want)
+	}
+
+	if _, err := URL("http://x/", &struct{ C chan int }{}); err == nil ||
+		err.Error() != "c: unsupported kind chan int" {
+		t.Errorf("URL with chan field: err = %v", err)
+	}
+}
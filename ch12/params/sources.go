@@ -0,0 +1,175 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// maxMemory is the number of bytes of a multipart body kept in
+// memory; the rest of its files are stored on disk.
+const maxMemory = 32 << 20
+
+// UnpackRoute is like Unpack, but takes the values of fields tagged
+// path:"name" from the request path, matched against a pattern such
+// as "/users/{id}/files/{name...}".  A wildcard {name} matches one
+// non-empty segment, and a final {name...} matches the rest of the
+// path.  If the path does not match, UnpackRoute returns an error.
+func UnpackRoute(req *http.Request, pattern string, ptr interface{}) error {
+	values, ok := matchRoute(pattern, req.URL.Path)
+	if !ok {
+		return fmt.Errorf("path %s does not match %s", req.URL.Path, pattern)
+	}
+	return unpack(req, ptr, func(name string) []string {
+		if value := values[name]; value != "" {
+			return []string{value}
+		}
+		return nil
+	})
+}
+
+// matchRoute matches path against pattern, returning the values of
+// its wildcards.
+func matchRoute(pattern, path string) (map[string]string, bool) {
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	values := make(map[string]string)
+	for i, p := range patterns {
+		wildcard := strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}")
+		if wildcard && i == len(patterns)-1 && strings.HasSuffix(p, "...}") {
+			if i <= len(segments) {
+				values[p[1:len(p)-len("...}")]] = strings.Join(segments[i:], "/")
+				return values, true
+			}
+			return nil, false
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		switch {
+		case wildcard && segments[i] != "":
+			values[p[1:len(p)-1]] = segments[i]
+		case p != segments[i]:
+			return nil, false
+		}
+	}
+	return values, len(segments) == len(patterns)
+}
+
+// parseBody parses the URL query and any form body of req.
+func parseBody(req *http.Request) error {
+	if mediaType(req) == "multipart/form-data" {
+		return req.ParseMultipartForm(maxMemory)
+	}
+	return req.ParseForm()
+}
+
+func mediaType(req *http.Request) string {
+	t, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return t
+}
+
+// decodeJSON decodes a JSON body of req into the struct v,
+// leaving unchanged the fields taken only from tagged sources.
+// The decoder would fill a non-nil map, pointer or slice in place,
+// so decodeJSON zeroes those fields while it decodes, then restores
+// their values.
+func decodeJSON(req *http.Request, v reflect.Value, fields []fieldInfo) error {
+	if mediaType(req) != "application/json" || req.Body == nil {
+		return nil
+	}
+	type saved struct {
+		f     fieldInfo
+		value reflect.Value
+	}
+	var restore []saved
+	for _, f := range fields {
+		if fv, ok := lookupField(v, f.index); ok && sourceOnly(f) {
+			value := reflect.New(f.typ).Elem()
+			value.Set(fv)
+			fv.Set(reflect.Zero(f.typ))
+			restore = append(restore, saved{f, value})
+		}
+	}
+	err := json.NewDecoder(req.Body).Decode(v.Addr().Interface())
+	for _, s := range restore {
+		fieldByIndex(v, s.f.index).Set(s.value)
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("body: %v", err)
+	}
+	return nil
+}
+
+var fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+
+// isFile reports whether a field of type t holds uploaded files.
+func isFile(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Ptr && t.Elem() == fileHeaderType
+}
+
+// unpackFiles sets each file field of the struct v to the files
+// of its name.
+func unpackFiles(v reflect.Value, fields map[string]fieldInfo, files map[string][]*multipart.FileHeader) {
+	for name, headers := range files {
+		info, ok := fields[name]
+		if !ok || !isFile(info.typ) || len(headers) == 0 {
+			continue
+		}
+		f := fieldByIndex(v, info.index)
+		if f.Kind() == reflect.Slice {
+			f.Set(reflect.ValueOf(headers))
+		} else {
+			f.Set(reflect.ValueOf(headers[len(headers)-1]))
+		}
+	}
+}
+
+// A source supplies the values of fields with a particular tag.
+type source struct {
+	tag    string
+	values func(req *http.Request, key string, path func(string) []string) []string
+}
+
+// sources lists the tagged sources in increasing order of precedence.
+var sources = []source{
+	{"path", func(req *http.Request, key string, path func(string) []string) []string {
+		return path(key)
+	}},
+	{"cookie", func(req *http.Request, key string, _ func(string) []string) []string {
+		var values []string
+		for _, c := range req.Cookies() {
+			if c.Name == key {
+				values = append(values, c.Value)
+			}
+		}
+		return values
+	}},
+	{"header", func(req *http.Request, key string, _ func(string) []string) []string {
+		return req.Header.Values(key)
+	}},
+}
+
+// sourceOnly reports whether field f is taken only from tagged sources.
+func sourceOnly(f fieldInfo) bool {
+	if _, ok := f.tag.Lookup("http"); ok {
+		return false
+	}
+	for _, src := range sources {
+		if _, ok := f.tag.Lookup(src.tag); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Item struct {
+	ID      string   `http:"id" path:"id" cookie:"id" header:"X-Id"`
+	Name    string   `json:"name"`
+	Labels  []string `http:"l" json:"labels"`
+	User    string   `header:"X-User"`
+	Session string   `cookie:"session"`
+	Avatar  *multipart.FileHeader
+	Docs    []*multipart.FileHeader `http:"doc"`
+}
+
+func TestPrecedence(t *testing.T) {
+	type request struct {
+		method, target, contentType, body string
+		cookies, headers                  map[string]string
+	}
+	for _, test := range []struct {
+		req  request
+		want Item
+	}{
+		// The URL query overrides a JSON body, even for slices,
+		// but a JSON body cannot set fields taken only from headers.
+		{request{method: "POST", target: "/items/?l=c",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name": "json", "labels": ["a", "b"], "User": "forged"}`},
+			Item{Name: "json", Labels: []string{"c"}}},
+		// A form body overrides the URL query.
+		{request{method: "POST", target: "/items/?name=query&l=y&l=z",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=body&l=x"},
+			Item{Name: "body", Labels: []string{"x"}}},
+		// The path overrides the query, cookies override the path,
+		// and headers override cookies.
+		{request{method: "GET", target: "/items/?id=query"},
+			Item{ID: "query"}},
+		{request{method: "GET", target: "/items/path?id=query"},
+			Item{ID: "path"}},
+		{request{method: "GET", target: "/items/path?id=query",
+			cookies: map[string]string{"id": "cookie", "session": "s1"}},
+			Item{ID: "cookie", Session: "s1"}},
+		{request{method: "GET", target: "/items/path?id=query",
+			cookies: map[string]string{"id": "cookie"},
+			headers: map[string]string{"X-Id": "header", "X-User": "alice"}},
+			Item{ID: "header", User: "alice"}},
+		// Fields taken only from headers and cookies
+		// cannot be set by parameters.
+		{request{method: "GET", target: "/items/?user=forged&session=forged"},
+			Item{}},
+	} {
+		req := httptest.NewRequest(test.req.method, test.req.target,
+			strings.NewReader(test.req.body))
+		if test.req.contentType != "" {
+			req.Header.Set("Content-Type", test.req.contentType)
+		}
+		for name, value := range test.req.cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		for name, value := range test.req.headers {
+			req.Header.Set(name, value)
+		}
+		var got Item
+		if err := UnpackRoute(req, "/items/{id...}", &got); err != nil {
+			t.Errorf("%+v: %v", test.req, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %+v, want %+v", test.req, got, test.want)
+		}
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("name", "upload")
+	w.WriteField("avatar", "not a file")
+	for _, file := range []struct{ field, name, content string }{
+		{"avatar", "me.png", "PNG"},
+		{"doc", "a.txt", "first"},
+		{"doc", "b.txt", "second"},
+	} {
+		fw, err := w.CreateFormFile(file.field, file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(fw, file.content)
+	}
+	w.Close()
+
+	req := httptest.NewRequest("POST", "/items/?l=q", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	var item Item
+	if err := Unpack(req, &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "upload" || !reflect.DeepEqual(item.Labels, []string{"q"}) {
+		t.Errorf("got %+v", item)
+	}
+	if item.Avatar == nil || item.Avatar.Filename != "me.png" {
+		t.Fatalf("Avatar = %+v", item.Avatar)
+	}
+	var docs []string
+	for _, h := range item.Docs {
+		f, err := h.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(f)
+		f.Close()
+		docs = append(docs, h.Filename+"="+string(data))
+	}
+	if want := []string{"a.txt=first", "b.txt=second"}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("Docs = %v, want %v", docs, want)
+	}
+
+	// Files are not parameters.
+	if params, err := Pack(&item); err != nil || params.Encode() != "id=&l=q&name=upload" {
+		t.Errorf("Pack = %v, %v", params.Encode(), err)
+	}
+}
+
+func TestPathValue(t *testing.T) {
+	// An http.ServeMux pattern such as "GET /items/{id}" sets the
+	// path value; this tree builds without the go.mod that enables
+	// such patterns, so set it as the ServeMux would.
+	req := httptest.NewRequest("GET", "/items/42?id=1&l=a", nil)
+	req.SetPathValue("id", "42")
+	var item Item
+	if err := Unpack(req, &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != "42" || !reflect.DeepEqual(item.Labels, []string{"a"}) {
+		t.Errorf("got %+v", item)
+	}
+}
+
+// TestJSONDefaults checks that a JSON body cannot change fields
+// taken only from headers, even through a default map or pointer
+// that the decoder would otherwise fill in place.
+func TestJSONDefaults(t *testing.T) {
+	type Request struct {
+		Name  string            `json:"name"`
+		Roles map[string]string `header:"X-Roles"`
+		Token *string           `header:"X-Token"`
+		Tags  []string          `header:"X-Tags"`
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(
+		`{"name": "json", "Roles": {"admin": "yes"}, "Token": "forged", "Tags": ["forged"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	token := "default"
+	got := Request{
+		Roles: map[string]string{"user": "yes"},
+		Token: &token,
+		Tags:  make([]string, 1, 10),
+	}
+	if err := Unpack(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "json" {
+		t.Errorf("Name = %q, want json", got.Name)
+	}
+	if want := map[string]string{"user": "yes"}; !reflect.DeepEqual(got.Roles, want) {
+		t.Errorf("Roles = %v, want %v", got.Roles, want)
+	}
+	if got.Token != &token || token != "default" {
+		t.Errorf("Token = %p (%q), want %p (\"default\")", got.Token, token, &token)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != "" {
+		t.Errorf("Tags = %q, want [\"\"]", got.Tags)
+	}
+}
+
+func TestBadJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	var item Item
+	err := Unpack(req, &item)
+	if err == nil || !strings.HasPrefix(err.Error(), "body: ") {
+		t.Errorf("Unpack = %v, want body error", err)
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	for _, test := range []struct {
+		pattern, path string
+		want          map[string]string // nil for no match
+	}{
+		{"/", "/", map[string]string{}},
+		{"/users/{id}", "/users/42", map[string]string{"id": "42"}},
+		{"/users/{id}", "/users/42/", map[string]string{"id": "42"}},
+		{"/users/{id}", "/users/", nil},
+		{"/users/{id}", "/users/42/posts", nil},
+		{"/users/{id}", "/groups/42", nil},
+		{"/users/{id}/posts/{post}", "/users/7/posts/8", map[string]string{"id": "7", "post": "8"}},
+		{"/files/{path...}", "/files/a/b/c", map[string]string{"path": "a/b/c"}},
+		{"/files/{path...}", "/files", map[string]string{"path": ""}},
+		{"/files/{path...}", "/", nil},
+	} {
+		got, ok := matchRoute(test.pattern, test.path)
+		if !ok {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("matchRoute(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/groups/1", nil)
+	if err := UnpackRoute(req, "/users/{id}", new(Item)); err == nil {
+		t.Errorf("UnpackRoute of non-matching path succeeded")
+	}
+}
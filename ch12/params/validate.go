@@ -0,0 +1,272 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package params
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Validate checks the fields of the struct pointed to by ptr against
+// the constraints in their validate tags, such as
+//
+//	MaxResults int `http:"max" validate:"min=1,max=100"`
+//
+// If any are violated, it returns an Errors keyed by parameter name,
+// with one error for each invalid field.  Unpack calls Validate itself.
+//
+// The tag is a comma-separated list of rules:
+//
+//	required    the value must not be zero, empty or nil
+//	min=N       a number must be at least N; a string (in runes),
+//	            slice or map must have at least N elements
+//	max=N       likewise, at most N
+//	len=N       a string, slice or map must have exactly N elements
+//	oneof=a|b   the value must be one of the listed texts
+//	email       the value must be a bare email address
+//	regexp=re   the value must match re; this rule must be last,
+//	            as it extends to the end of the tag
+//
+// The bounds of a time.Duration are durations, such as min=1s.
+// The rules oneof, email and regexp apply to each element of a slice.
+// Only required is checked for an empty string or a nil pointer, and
+// fields of a nested struct are not checked if its pointer is nil.
+// Validate panics if a tag is malformed.
+func Validate(ptr interface{}) error {
+	errs := make(Errors)
+	validate(reflect.ValueOf(ptr).Elem(), errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validate adds to errs an error for each invalid field of the
+// struct v that does not already have one.
+func validate(v reflect.Value, errs Errors) {
+	for _, f := range structFields(v.Type()) {
+		tag, ok := f.tag.Lookup("validate")
+		if !ok || errs[f.name] != nil {
+			continue
+		}
+		fv, ok := lookupField(v, f.index)
+		if !ok {
+			continue // within a nil struct pointer
+		}
+		if err := check(fv, parseRules(tag)); err != nil {
+			errs[f.name] = err
+		}
+	}
+}
+
+// lookupField is like fieldByIndex, but reports false instead of
+// allocating a nil struct pointer.
+func lookupField(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// A rule is one constraint of a validate tag.
+type rule struct {
+	name string // required, min, max, len, oneof, email or regexp
+	arg  string
+	re   *regexp.Regexp // for regexp
+}
+
+var rulesCache sync.Map // map[string][]rule, keyed by tag
+
+// parseRules returns the rules of a validate tag.
+func parseRules(tag string) []rule {
+	if rules, ok := rulesCache.Load(tag); ok {
+		return rules.([]rule)
+	}
+	var rules []rule
+	for rest := tag; rest != ""; {
+		item := rest
+		if strings.HasPrefix(item, "regexp=") {
+			rest = "" // the pattern may contain commas
+		} else if i := strings.IndexByte(item, ','); i >= 0 {
+			item, rest = item[:i], item[i+1:]
+		} else {
+			rest = ""
+		}
+		r := rule{name: item}
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			r.name, r.arg = item[:i], item[i+1:]
+		}
+		switch r.name {
+		case "required", "email":
+			if r.arg != "" {
+				panic(fmt.Sprintf("params: rule %s takes no argument in tag %q", r.name, tag))
+			}
+		case "min", "max", "len", "oneof":
+			if r.arg == "" {
+				panic(fmt.Sprintf("params: rule %s needs an argument in tag %q", r.name, tag))
+			}
+		case "regexp":
+			re, err := regexp.Compile(r.arg)
+			if err != nil {
+				panic(fmt.Sprintf("params: bad regexp in tag %q: %v", tag, err))
+			}
+			r.re = re
+		default:
+			panic(fmt.Sprintf("params: unknown rule %q in tag %q", r.name, tag))
+		}
+		rules = append(rules, r)
+	}
+	rulesCache.Store(tag, rules)
+	return rules
+}
+
+// check checks the field value v against rules.
+func check(v reflect.Value, rules []rule) error {
+	for _, r := range rules {
+		if r.name == "required" {
+			if v.IsZero() || isCollection(v) && v.Len() == 0 {
+				return errors.New("is required")
+			}
+		}
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String && v.Len() == 0 {
+		return nil
+	}
+
+	for _, r := range rules {
+		var err error
+		switch r.name {
+		case "min", "max", "len":
+			err = checkBound(v, r)
+		case "oneof", "email", "regexp":
+			if v.Kind() == reflect.Slice && !isLeaf(v.Type()) {
+				for i := 0; i < v.Len() && err == nil; i++ {
+					err = checkText(v.Index(i), r)
+				}
+			} else {
+				err = checkText(v, r)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isCollection(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return true
+	}
+	return false
+}
+
+var boundText = map[string]string{"min": "at least ", "max": "at most ", "len": ""}
+
+// checkBound checks v against a min, max or len rule.
+func checkBound(v reflect.Value, r rule) error {
+	var cmp int // sign of v - r.arg
+	var err error
+	length := false
+	switch k := v.Kind(); {
+	case v.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(r.arg)
+		cmp = compare(v.Int() < int64(d), v.Int() > int64(d))
+	case k >= reflect.Int && k <= reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(r.arg, 10, 64)
+		cmp = compare(v.Int() < n, v.Int() > n)
+	case k >= reflect.Uint && k <= reflect.Uintptr:
+		var n uint64
+		n, err = strconv.ParseUint(r.arg, 10, 64)
+		cmp = compare(v.Uint() < n, v.Uint() > n)
+	case k == reflect.Float32 || k == reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(r.arg, 64)
+		cmp = compare(v.Float() < n, v.Float() > n)
+	case isCollection(v):
+		n := v.Len()
+		if k == reflect.String {
+			n = utf8.RuneCountInString(v.String())
+		}
+		var m int
+		m, err = strconv.Atoi(r.arg)
+		cmp = compare(n < m, n > m)
+		length = true
+	default:
+		panic(fmt.Sprintf("params: rule %s does not apply to %s", r.name, v.Type()))
+	}
+	if err != nil {
+		panic(fmt.Sprintf("params: bad bound in rule %s=%s: %v", r.name, r.arg, err))
+	}
+	if r.name == "len" && !length {
+		panic(fmt.Sprintf("params: rule len does not apply to %s", v.Type()))
+	}
+
+	if r.name == "min" && cmp < 0 || r.name == "max" && cmp > 0 || r.name == "len" && cmp != 0 {
+		if length {
+			return fmt.Errorf("length must be %s%s", boundText[r.name], r.arg)
+		}
+		return fmt.Errorf("must be %s%s", boundText[r.name], r.arg)
+	}
+	return nil
+}
+
+func compare(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return +1
+	}
+	return 0
+}
+
+// checkText checks the text of v against a oneof, email or regexp rule.
+func checkText(v reflect.Value, r rule) error {
+	s, err := formatParam(v)
+	if err != nil {
+		return err
+	}
+	switch r.name {
+	case "oneof":
+		for _, t := range strings.Split(r.arg, "|") {
+			if s == t {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Replace(r.arg, "|", ", ", -1))
+	case "email":
+		if a, err := mail.ParseAddress(s); err != nil || a.Address != s {
+			return errors.New("must be an email address")
+		}
+	case "regexp":
+		if !r.re.MatchString(s) {
+			return fmt.Errorf("must match %s", r.arg)
+		}
+	}
+	return nil
+}
@@ -20,7 +20,7 @@ import "gopl.io/ch12/params"
 func search(resp http.ResponseWriter, req *http.Request) {
 	var data struct {
 		Labels     []string `http:"l"`
-		MaxResults int      `http:"max"`
+		MaxResults int      `http:"max" validate:"min=1,max=100"`
 		Exact      bool     `http:"x"`
 	}
 	data.MaxResults = 10 // set default
@@ -56,5 +56,7 @@ $ ./fetch 'http://localhost:12345/search?q=hello&x=123'
 x: strconv.ParseBool: parsing "123": invalid syntax
 $ ./fetch 'http://localhost:12345/search?q=hello&max=lots'
 max: strconv.ParseInt: parsing "lots": invalid syntax
+$ ./fetch 'http://localhost:12345/search?max=1000&x=123'
+max: must be at most 100; x: strconv.ParseBool: parsing "123": invalid syntax
 //!-output
 */
@@ -0,0 +1,424 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+// This file implements faster versions of encode and read.  Instead
+// of inspecting the type of every value it meets, each builds, once
+// per type, a function that knows how to encode or decode values of
+// that type, and caches it.  Struct field names are likewise computed
+// once and shared with pretty and readList.  Atoms are formatted with
+// the strconv.Append functions, avoiding the allocations of fmt.
+//
+// The results are identical to those of encode and read, which remain
+// the reference implementations.  A decoder handles the common cases
+// itself, and leaves the rest, such as nil and datum labels, to read.
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"text/scanner"
+)
+
+// An encoderFunc appends the S-expression form of v to b.
+type encoderFunc func(b []byte, v reflect.Value, s *state) ([]byte, error)
+
+var encoders sync.Map // map[reflect.Type]encoderFunc
+
+// typeEncoder returns the cached encoder for type t, building it if
+// necessary.
+func typeEncoder(t reflect.Type) encoderFunc {
+	if f, ok := encoders.Load(t); ok {
+		return f.(encoderFunc)
+	}
+
+	// To deal with recursive types, store an indirect func before
+	// building the real one.  Callers that find the indirect func
+	// wait for the real one to be ready.
+	var (
+		wg sync.WaitGroup
+		f  encoderFunc
+	)
+	wg.Add(1)
+	fi, loaded := encoders.LoadOrStore(t, encoderFunc(
+		func(b []byte, v reflect.Value, s *state) ([]byte, error) {
+			wg.Wait()
+			return f(b, v, s)
+		}))
+	if loaded {
+		return fi.(encoderFunc)
+	}
+	f = newTypeEncoder(t)
+	wg.Done()
+	encoders.Store(t, f)
+	return f
+}
+
+func newTypeEncoder(t reflect.Type) encoderFunc {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return func(b []byte, v reflect.Value, _ *state) ([]byte, error) {
+			return strconv.AppendInt(b, v.Int(), 10), nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(b []byte, v reflect.Value, _ *state) ([]byte, error) {
+			return strconv.AppendUint(b, v.Uint(), 10), nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		return func(b []byte, v reflect.Value, _ *state) ([]byte, error) {
+			return appendFloat(b, v), nil
+		}
+
+	case reflect.String:
+		if t == symbolType {
+			return func(b []byte, v reflect.Value, _ *state) ([]byte, error) {
+				return append(b, v.String()...), nil
+			}
+		}
+		return func(b []byte, v reflect.Value, _ *state) ([]byte, error) {
+			return strconv.AppendQuote(b, v.String()), nil
+		}
+
+	case reflect.Ptr:
+		elem := typeEncoder(t.Elem())
+		return func(b []byte, v reflect.Value, s *state) ([]byte, error) {
+			if v.IsNil() {
+				return append(b, "nil"...), nil
+			}
+			label, done := s.labels.mark(v)
+			b = append(b, label...)
+			if done {
+				return b, nil
+			}
+			return elem(b, v.Elem(), s)
+		}
+
+	case reflect.Interface:
+		return func(b []byte, v reflect.Value, s *state) ([]byte, error) {
+			if v.IsNil() {
+				return append(b, "nil"...), nil
+			}
+			e := v.Elem()
+			return typeEncoder(e.Type())(b, e, s)
+		}
+
+	case reflect.Array, reflect.Slice: // (value ...)
+		elem := typeEncoder(t.Elem())
+		return func(b []byte, v reflect.Value, s *state) ([]byte, error) {
+			b = append(b, '(')
+			var err error
+			for i, n := 0, v.Len(); i < n; i++ {
+				if i > 0 {
+					b = append(b, ' ')
+				}
+				if b, err = elem(b, v.Index(i), s); err != nil {
+					return b, err
+				}
+			}
+			return append(b, ')'), nil
+		}
+
+	case reflect.Struct: // ((name value) ...)
+		fields := cachedFields(t)
+		elems := make([]encoderFunc, len(fields))
+		prefixes := make([]string, len(fields))
+		for i, f := range fields {
+			elems[i] = typeEncoder(t.Field(i).Type)
+			prefixes[i] = "(" + f.name + " "
+			if i > 0 {
+				prefixes[i] = " " + prefixes[i]
+			}
+		}
+		return func(b []byte, v reflect.Value, s *state) ([]byte, error) {
+			b = append(b, '(')
+			var err error
+			for i, elem := range elems {
+				b = append(b, prefixes[i]...)
+				if b, err = elem(b, v.Field(i), s); err != nil {
+					return b, err
+				}
+				b = append(b, ')')
+			}
+			return append(b, ')'), nil
+		}
+
+	case reflect.Map: // ((key value) ...)
+		key, elem := typeEncoder(t.Key()), typeEncoder(t.Elem())
+		return func(b []byte, v reflect.Value, s *state) ([]byte, error) {
+			b = append(b, '(')
+			var err error
+			for i, k := range s.mapKeys(v) {
+				if i > 0 {
+					b = append(b, ' ')
+				}
+				b = append(b, '(')
+				if b, err = key(b, k, s); err != nil {
+					return b, err
+				}
+				b = append(b, ' ')
+				if b, err = elem(b, v.MapIndex(k), s); err != nil {
+					return b, err
+				}
+				b = append(b, ')')
+			}
+			return append(b, ')'), nil
+		}
+
+	default: // complex, bool, chan, func
+		return func(b []byte, v reflect.Value, _ *state) ([]byte, error) {
+			return b, fmt.Errorf("unsupported type: %s", v.Type())
+		}
+	}
+}
+
+// appendFloat appends the floating-point value v to b so that it
+// reads back as a float, not an integer.
+func appendFloat(b []byte, v reflect.Value) []byte {
+	start := len(b)
+	b = strconv.AppendFloat(b, v.Float(), 'g', -1, v.Type().Bits())
+	for _, c := range b[start:] {
+		switch c {
+		case '.', 'e', 'I', 'N': // fraction, exponent, Inf, NaN
+			return b
+		}
+	}
+	return append(b, ".0"...)
+}
+
+// appendValue appends the S-expression form of v to b.
+func appendValue(b []byte, v reflect.Value, s *state) ([]byte, error) {
+	if !v.IsValid() {
+		return append(b, "nil"...), nil
+	}
+	return typeEncoder(v.Type())(b, v, s)
+}
+
+var buffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// encodeValue returns the S-expression form of v.  It encodes into a
+// reused buffer and returns a copy of exactly the right size, which
+// saves the garbage of growing a new buffer each time.
+func encodeValue(v reflect.Value, s *state) ([]byte, error) {
+	buf := buffers.Get().(*[]byte)
+	defer buffers.Put(buf)
+	b, err := appendValue((*buf)[:0], v, s)
+	*buf = b[:0]
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// A fieldInfo describes one field of a struct type.
+type fieldInfo struct {
+	name string
+}
+
+// A structInfo holds the fields of a struct type, in order,
+// and an index of them by name.
+type structInfo struct {
+	fields []fieldInfo
+	index  map[string]int
+}
+
+var structs sync.Map // map[reflect.Type]*structInfo
+
+func cachedStruct(t reflect.Type) *structInfo {
+	if info, ok := structs.Load(t); ok {
+		return info.(*structInfo)
+	}
+	info := &structInfo{index: make(map[string]int)}
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		info.fields = append(info.fields, fieldInfo{name})
+		if _, ok := info.index[name]; !ok {
+			info.index[name] = i
+		}
+	}
+	actual, _ := structs.LoadOrStore(t, info)
+	return actual.(*structInfo)
+}
+
+// cachedFields returns the fields of the struct type t.
+func cachedFields(t reflect.Type) []fieldInfo { return cachedStruct(t).fields }
+
+// fieldByName returns the field of struct v with the given name,
+// or the zero Value if there is none.
+func fieldByName(v reflect.Value, name string) reflect.Value {
+	i, ok := cachedStruct(v.Type()).index[name]
+	if !ok {
+		return reflect.Value{}
+	}
+	return v.Field(i)
+}
+
+// A decoderFunc reads an S-expression from lex into v.
+type decoderFunc func(lex *lexer, v reflect.Value)
+
+var decoders sync.Map // map[reflect.Type]decoderFunc
+
+// typeDecoder returns the cached decoder for type t, building it if
+// necessary.  Recursive types are handled as in typeEncoder.
+func typeDecoder(t reflect.Type) decoderFunc {
+	if f, ok := decoders.Load(t); ok {
+		return f.(decoderFunc)
+	}
+	var (
+		wg sync.WaitGroup
+		f  decoderFunc
+	)
+	wg.Add(1)
+	fi, loaded := decoders.LoadOrStore(t, decoderFunc(
+		func(lex *lexer, v reflect.Value) {
+			wg.Wait()
+			f(lex, v)
+		}))
+	if loaded {
+		return fi.(decoderFunc)
+	}
+	f = newTypeDecoder(t)
+	wg.Done()
+	decoders.Store(t, f)
+	return f
+}
+
+// decodeValue reads an S-expression from lex into v.
+func decodeValue(lex *lexer, v reflect.Value) {
+	typeDecoder(v.Type())(lex, v)
+}
+
+// isNil reports whether the current token is the identifier nil.
+func (lex *lexer) isNil() bool {
+	return lex.token == scanner.Ident && lex.text() == "nil"
+}
+
+func newTypeDecoder(t reflect.Type) decoderFunc {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr, reflect.Float32, reflect.Float64:
+		return func(lex *lexer, v reflect.Value) {
+			switch lex.token {
+			case scanner.Int, scanner.Float, '-':
+				readNumber(lex, v)
+			default:
+				read(lex, v)
+			}
+		}
+
+	case reflect.String:
+		symbol := t == symbolType
+		return func(lex *lexer, v reflect.Value) {
+			switch {
+			case lex.token == scanner.String:
+				s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
+				v.SetString(s)
+				lex.next()
+			case symbol && lex.token == scanner.Ident && !lex.isNil():
+				v.SetString(lex.text())
+				lex.next()
+			default:
+				read(lex, v)
+			}
+		}
+
+	case reflect.Ptr:
+		elemType := t.Elem()
+		elem := typeDecoder(elemType)
+		return func(lex *lexer, v reflect.Value) {
+			if lex.token == '#' || lex.isNil() {
+				read(lex, v)
+				return
+			}
+			// A pointer is written as the value it points to.
+			p := reflect.New(elemType)
+			v.Set(p)
+			elem(lex, p.Elem())
+		}
+
+	case reflect.Array, reflect.Slice, reflect.Struct, reflect.Map:
+		list := newListDecoder(t)
+		return func(lex *lexer, v reflect.Value) {
+			if lex.token != '(' {
+				read(lex, v)
+				return
+			}
+			lex.next()
+			list(lex, v)
+			lex.next() // consume ')'
+		}
+
+	default: // interface, bool, complex, chan, func
+		return read
+	}
+}
+
+// newListDecoder returns a decoder for the items of a list, up to but
+// not including its closing parenthesis, into a variable of type t.
+func newListDecoder(t reflect.Type) decoderFunc {
+	switch t.Kind() {
+	case reflect.Array: // (item ...)
+		elem := typeDecoder(t.Elem())
+		return func(lex *lexer, v reflect.Value) {
+			for i := 0; !endList(lex); i++ {
+				elem(lex, v.Index(i))
+			}
+		}
+
+	case reflect.Slice: // (item ...)
+		elem, zero := typeDecoder(t.Elem()), reflect.Zero(t.Elem())
+		return func(lex *lexer, v reflect.Value) {
+			for !endList(lex) {
+				v.Set(reflect.Append(v, zero))
+				elem(lex, v.Index(v.Len()-1))
+			}
+		}
+
+	case reflect.Struct: // ((name value) ...)
+		info := cachedStruct(t)
+		elems := make([]decoderFunc, len(info.fields))
+		for i := range elems {
+			elems[i] = typeDecoder(t.Field(i).Type)
+		}
+		return func(lex *lexer, v reflect.Value) {
+			for !endList(lex) {
+				lex.consume('(')
+				if lex.token != scanner.Ident {
+					panic(fmt.Sprintf("got token %q, want field name", lex.text()))
+				}
+				i, ok := info.index[lex.text()]
+				lex.next()
+				if ok {
+					elems[i](lex, v.Field(i))
+				} else {
+					read(lex, reflect.Value{})
+				}
+				lex.consume(')')
+			}
+		}
+
+	default: // map: ((key value) ...)
+		keyType, elemType := t.Key(), t.Elem()
+		key, elem := typeDecoder(keyType), typeDecoder(elemType)
+		return func(lex *lexer, v reflect.Value) {
+			v.Set(reflect.MakeMap(t))
+			k := reflect.New(keyType).Elem()
+			e := reflect.New(elemType).Elem()
+			for !endList(lex) {
+				lex.consume('(')
+				k.SetZero()
+				key(lex, k)
+				e.SetZero()
+				elem(lex, e)
+				v.SetMapIndex(k, e)
+				lex.consume(')')
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"text/scanner"
+)
+
+type benchMovie struct {
+	Title, Subtitle string
+	Year            int
+	Actor           map[string]string
+	Oscars          []string
+	Sequel          *string
+}
+
+// benchStrangelove is the value encoded and decoded by the benchmarks.
+var benchStrangelove = benchMovie{
+	Title:    "Dr. Strangelove",
+	Subtitle: "How I Learned to Stop Worrying and Love the Bomb",
+	Year:     1964,
+	Actor: map[string]string{
+		"Dr. Strangelove":            "Peter Sellers",
+		"Grp. Capt. Lionel Mandrake": "Peter Sellers",
+		"Pres. Merkin Muffley":       "Peter Sellers",
+		"Gen. Buck Turgidson":        "George C. Scott",
+		"Brig. Gen. Jack D. Ripper":  "Sterling Hayden",
+		`Maj. T.J. "King" Kong`:      "Slim Pickens",
+	},
+	Oscars: []string{
+		"Best Actor (Nomin.)",
+		"Best Adapted Screenplay (Nomin.)",
+		"Best Director (Nomin.)",
+		"Best Picture (Nomin.)",
+	},
+}
+
+// TestEncoders verifies that the cached encoders used by Marshal
+// produce the same output as the reference implementation, encode.
+func TestEncoders(t *testing.T) {
+	type Node struct {
+		Value  float64
+		Kids   []*Node
+		Name   Symbol
+		Extra  interface{}
+		Counts map[int]uint8
+	}
+	sequel := "Dr. Strangelove II"
+	movie := benchStrangelove
+	movie.Sequel = &sequel
+	tree := &Node{Value: 1, Kids: []*Node{{Value: -2.5}, nil}, Name: "root",
+		Extra: []interface{}{int64(3), "x"}, Counts: map[int]uint8{7: 1, -1: 2}}
+	for _, v := range []interface{}{nil, 42, "hi", movie, tree, [2]bool{}} {
+		opts := MarshalOptions{SortKeys: true}
+		got, gotErr := opts.Marshal(v)
+		var want bytes.Buffer
+		wantErr := encode(&want, reflect.ValueOf(v), &state{sortKeys: true})
+		if (gotErr != nil) != (wantErr != nil) {
+			t.Errorf("Marshal(%#v): error %v, want %v", v, gotErr, wantErr)
+		} else if gotErr == nil && string(got) != want.String() {
+			t.Errorf("Marshal(%#v) = %s, want %s", v, got, want.String())
+		}
+	}
+
+	// On error, Marshal returns no partial output.
+	bad := struct {
+		Name string
+		Ch   chan int
+	}{Name: "x"}
+	if data, err := Marshal(bad); err == nil || data != nil {
+		t.Errorf("Marshal(%#v) = %q, %v, want nil and an error", bad, data, err)
+	}
+}
+
+// TestDecoders verifies that the cached decoders used by Unmarshal
+// produce the same results as the reference implementation, read.
+func TestDecoders(t *testing.T) {
+	type Node struct {
+		Value  float64
+		Kids   []*Node
+		Name   Symbol
+		Extra  interface{}
+		Counts map[int]uint8
+		Pair   [2]int8
+		Next   *Node
+	}
+	sequel := "Dr. Strangelove II"
+	movie := benchStrangelove
+	movie.Sequel = &sequel
+	shared := &Node{Value: 3, Name: "shared"}
+	cyclic := &Node{Name: "loop"}
+	cyclic.Next = cyclic
+	for _, v := range []interface{}{
+		movie,
+		&Node{Value: 1, Kids: []*Node{{Value: -2.5, Name: "kid"}, nil}, Name: "root",
+			Extra: []interface{}{int64(3), "x"}, Counts: map[int]uint8{7: 1, -1: 2},
+			Pair: [2]int8{-1, 1}},
+		&Node{Kids: []*Node{shared, shared}, Name: "parent"},
+		cyclic,
+	} {
+		opts := MarshalOptions{SortKeys: true, Shared: true}
+		data, err := opts.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decode := func(dec func(*lexer, reflect.Value)) (interface{}, error) {
+			ptr := reflect.New(reflect.TypeOf(v))
+			lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
+			lex.scan.Init(bytes.NewReader(data))
+			lex.next()
+			err := func() (err error) {
+				defer func() {
+					if x := recover(); x != nil {
+						err = fmt.Errorf("%v", x)
+					}
+				}()
+				dec(lex, ptr.Elem())
+				return nil
+			}()
+			out, _ := opts.Marshal(ptr.Elem().Interface())
+			return string(out), err
+		}
+		got, gotErr := decode(decodeValue)
+		want, wantErr := decode(read)
+		if got != want || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Errorf("decoding %s: got %s, %v, want %s, %v", data, got, gotErr, want, wantErr)
+		}
+		if got != string(data) {
+			t.Errorf("decoding %s: got %s", data, got)
+		}
+	}
+}
+
+// The benchmarks compare Marshal and Unmarshal, which use the cached
+// encoders and decoders, with the reference implementations:
+//
+// 	$ go test -bench=. gopl.io/ch12/sexpr
+
+func BenchmarkMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(benchStrangelove); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalReference(b *testing.B) {
+	b.ReportAllocs()
+	v := reflect.ValueOf(benchStrangelove)
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := encode(&buf, v, &state{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalReference(b *testing.B) {
+	b.ReportAllocs()
+	data, err := Marshal(benchStrangelove)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		var movie benchMovie
+		lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
+		lex.scan.Init(bytes.NewReader(data))
+		lex.next()
+		read(lex, reflect.ValueOf(&movie).Elem())
+	}
+}
+
+func BenchmarkMarshalIndent(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalIndent(benchStrangelove); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	b.ReportAllocs()
+	data, err := Marshal(benchStrangelove)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		var movie benchMovie
+		if err := Unmarshal(data, &movie); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Sjson converts S-expressions on the standard input to JSON on the
+// standard output, or, with -r, JSON to S-expressions.
+// See sexpr.ToJSON for the mapping between the two.
+//
+//	$ echo '((Title "Casablanca") (Year 1942) (Oscars ("Best Picture")))' | sjson
+//	{"Title":"Casablanca","Year":1942,"Oscars":["Best Picture"]}
+//	$ echo '{"Title":"Casablanca","Cast":[["Rick","Bogart"]]}' | sjson -r
+//	((Title "Casablanca") (Cast #(("Rick" "Bogart"))))
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopl.io/ch12/sexpr"
+)
+
+var reverse = flag.Bool("r", false, "convert JSON to S-expressions")
+
+func main() {
+	flag.Parse()
+	convert := sexpr.ToJSON
+	if *reverse {
+		convert = sexpr.FromJSON
+	}
+	if err := convert(os.Stdout, os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "sjson: %v\n", err)
+		os.Exit(1)
+	}
+}
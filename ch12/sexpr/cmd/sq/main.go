@@ -0,0 +1,119 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Sq queries S-expression documents, in the manner of jq.
+//
+// Usage:
+//
+//	sq [-c] query [file ...]
+//
+// Sq reads a sequence of S-expressions from each file (or from the
+// standard input) and prints the values selected by the query, one
+// per line, using sexpr.MarshalIndent, or sexpr.Marshal if -c is set.
+//
+// A query is one or more paths separated by white space or commas.
+// Each path is a sequence of steps applied in turn:
+//
+//	.          the document itself
+//	.Name      the Name field of a struct ((Name value) ...)
+//	[n]        the nth element of a list
+//	[key]      the value of key in a map ((key value) ...);
+//	["key"]    keys may be symbols or quoted strings
+//	[]         each element of a list
+//	?(p op x)  the value, if path p yields a value v for which "v op x"
+//	           holds; op is one of = != < <= > >=
+//	{A,B}      a struct with only the fields A and B
+//
+// For example, given the output of sexpr.Marshal for a Movie:
+//
+//	$ sq '.Actor["Dr. Strangelove"] .Oscars[0]' movie.sexpr
+//	"Peter Sellers"
+//	"Best Actor (Nomin.)"
+//	$ sq '?(.Year<1970){Title,Year}' movies.sexpr
+//	((Title "Dr. Strangelove") (Year 1964))
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopl.io/ch12/sexpr"
+)
+
+var compact = flag.Bool("c", false, "compact output")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sq [-c] query [file ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	q, err := parse(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sq: %v\n", err)
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	files := flag.Args()[1:]
+	if len(files) == 0 {
+		if err := run(out, q, os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "sq: %v\n", err)
+			out.Flush()
+			os.Exit(1)
+		}
+		return
+	}
+	status := 0
+	for _, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sq: %v\n", err)
+			status = 1
+			continue
+		}
+		err = run(out, q, f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sq: %s: %v\n", filename, err)
+			status = 1
+		}
+	}
+	out.Flush()
+	os.Exit(status)
+}
+
+// run evaluates q against each document in r and writes the results to out.
+func run(out io.Writer, q query, r io.Reader) error {
+	dec := sexpr.NewDecoder(r)
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, x := range q.eval(doc) {
+			var data []byte
+			var err error
+			if *compact {
+				data, err = sexpr.Marshal(x)
+			} else {
+				data, err = sexpr.MarshalIndent(x)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s\n", data)
+		}
+	}
+}
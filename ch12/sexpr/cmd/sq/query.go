@@ -0,0 +1,370 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"gopl.io/ch12/sexpr"
+)
+
+// A query is a list of alternative paths.  Each path is a sequence
+// of steps, each of which maps one value to zero or more values.
+type query [][]step
+
+// A step is one component of a path.
+type step interface {
+	eval(x interface{}) []interface{}
+}
+
+type (
+	self    struct{} // .: the value itself
+	field   string   // .Name: the value of field Name of a struct
+	index   int      // [n]: the nth element of a list
+	key     string   // [key]: the value of key in a map
+	each    struct{} // []: every element of a list
+	project []string // {A,B}: a struct with only the named fields
+	filter  struct { // ?(path op literal): x if the condition holds
+		path []step
+		op   string
+		lit  interface{}
+	}
+)
+
+// parse parses a query.  Paths are separated by white space or
+// commas; within a path, steps must not be separated by white space
+// (except inside a filter).
+//
+//	.Actor[Grace] .Oscars[0]
+//	.[]?(.Year>=1960){Title,Year}
+func parse(input string) (q query, err error) {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(input))
+	s.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats |
+		scanner.ScanStrings
+	s.Error = func(s *scanner.Scanner, msg string) {} // reported below
+	p := &parser{scan: &s}
+	p.next()
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("query: at offset %d: %v", p.scan.Position.Offset, x)
+		}
+	}()
+	for p.token != scanner.EOF {
+		if p.token == ',' {
+			p.next()
+			continue
+		}
+		q = append(q, p.path(false))
+	}
+	return q, nil
+}
+
+type parser struct {
+	scan  *scanner.Scanner
+	token rune
+	space bool // white space precedes the current token
+}
+
+func (p *parser) next() {
+	end := p.scan.Pos().Offset
+	p.token = p.scan.Scan()
+	p.space = p.scan.Position.Offset > end
+}
+
+func (p *parser) text() string { return p.scan.TokenText() }
+
+func (p *parser) consume(want rune) {
+	if p.token != want {
+		panic(fmt.Sprintf("got %q, want %q", p.text(), want))
+	}
+	p.next()
+}
+
+// path parses a sequence of steps.  Within a filter, white space
+// does not end the path.
+func (p *parser) path(inFilter bool) []step {
+	var steps []step
+	for {
+		if len(steps) > 0 && p.space && !inFilter {
+			return steps
+		}
+		switch p.token {
+		case '.':
+			p.next()
+			if p.token == scanner.Ident && !p.space {
+				steps = append(steps, field(p.text()))
+				p.next()
+			} else {
+				steps = append(steps, self{})
+			}
+		case '[':
+			p.next()
+			steps = append(steps, p.subscript())
+		case '{':
+			p.next()
+			var names project
+			for p.token != '}' {
+				if p.token != scanner.Ident {
+					panic(fmt.Sprintf("got %q, want field name", p.text()))
+				}
+				names = append(names, p.text())
+				p.next()
+				if p.token == ',' {
+					p.next()
+				}
+			}
+			p.next() // consume '}'
+			steps = append(steps, names)
+		case '?':
+			p.next()
+			p.consume('(')
+			var f filter
+			f.path = p.path(true)
+			f.op = p.operator()
+			f.lit = p.literal()
+			p.consume(')')
+			steps = append(steps, f)
+		default:
+			if len(steps) == 0 {
+				panic(fmt.Sprintf("unexpected %q", p.text()))
+			}
+			return steps
+		}
+	}
+}
+
+// subscript parses the remainder of [], [n], [key] or ["key"].
+func (p *parser) subscript() step {
+	var s step
+	switch p.token {
+	case ']':
+		s = each{}
+	case scanner.Int:
+		n, err := strconv.Atoi(p.text())
+		if err != nil {
+			panic(err)
+		}
+		s = index(n)
+		p.next()
+	case scanner.Ident:
+		s = key(p.text())
+		p.next()
+	case scanner.String:
+		k, err := strconv.Unquote(p.text())
+		if err != nil {
+			panic(err)
+		}
+		s = key(k)
+		p.next()
+	default:
+		panic(fmt.Sprintf("got %q, want index or key", p.text()))
+	}
+	p.consume(']')
+	return s
+}
+
+// operator parses one of = != < <= > >=.
+func (p *parser) operator() string {
+	var op string
+	switch p.token {
+	case '=', '<', '>', '!':
+		op = string(p.token)
+		p.next()
+	default:
+		panic(fmt.Sprintf("got %q, want comparison", p.text()))
+	}
+	if p.token == '=' && !p.space {
+		op += "="
+		p.next()
+	}
+	if op == "!" {
+		panic("got '!', want '!='")
+	}
+	return op
+}
+
+// literal parses a number, string or symbol.
+func (p *parser) literal() interface{} {
+	neg := p.token == '-'
+	if neg {
+		p.next()
+	}
+	var lit interface{}
+	switch p.token {
+	case scanner.Int, scanner.Float:
+		f, err := strconv.ParseFloat(p.text(), 64)
+		if err != nil {
+			panic(err)
+		}
+		if neg {
+			f = -f
+		}
+		lit = f
+	case scanner.String:
+		s, err := strconv.Unquote(p.text())
+		if err != nil {
+			panic(err)
+		}
+		lit = s
+	case scanner.Ident:
+		if p.text() == "nil" {
+			lit = nil
+		} else {
+			lit = p.text()
+		}
+	default:
+		panic(fmt.Sprintf("got %q, want literal", p.text()))
+	}
+	p.next()
+	return lit
+}
+
+// eval applies q to the document x and returns the results in order.
+func (q query) eval(x interface{}) []interface{} {
+	var results []interface{}
+	for _, path := range q {
+		results = append(results, evalPath(path, x)...)
+	}
+	return results
+}
+
+func evalPath(path []step, x interface{}) []interface{} {
+	xs := []interface{}{x}
+	for _, s := range path {
+		var next []interface{}
+		for _, x := range xs {
+			next = append(next, s.eval(x)...)
+		}
+		xs = next
+	}
+	return xs
+}
+
+// A struct or map is written as a list of (key value) pairs.
+// pair reports whether x is such a pair, and if so returns its parts.
+func pair(x interface{}) (k, v interface{}, ok bool) {
+	list, ok := x.([]interface{})
+	if !ok || len(list) != 2 {
+		return nil, nil, false
+	}
+	return list[0], list[1], true
+}
+
+func (self) eval(x interface{}) []interface{} { return []interface{}{x} }
+
+func (f field) eval(x interface{}) []interface{} {
+	list, _ := x.([]interface{})
+	for _, elem := range list {
+		if k, v, ok := pair(elem); ok && k == sexpr.Symbol(f) {
+			return []interface{}{v}
+		}
+	}
+	return nil
+}
+
+func (i index) eval(x interface{}) []interface{} {
+	list, _ := x.([]interface{})
+	if i < 0 || int(i) >= len(list) {
+		return nil
+	}
+	return []interface{}{list[i]}
+}
+
+func (k key) eval(x interface{}) []interface{} {
+	list, _ := x.([]interface{})
+	for _, elem := range list {
+		if kx, v, ok := pair(elem); ok && text(kx) == string(k) {
+			return []interface{}{v}
+		}
+	}
+	return nil
+}
+
+func (each) eval(x interface{}) []interface{} {
+	list, _ := x.([]interface{})
+	return list
+}
+
+func (names project) eval(x interface{}) []interface{} {
+	result := []interface{}{}
+	for _, name := range names {
+		for _, v := range field(name).eval(x) {
+			result = append(result, []interface{}{sexpr.Symbol(name), v})
+		}
+	}
+	return []interface{}{result}
+}
+
+func (f filter) eval(x interface{}) []interface{} {
+	for _, y := range evalPath(f.path, x) {
+		if compare(y, f.op, f.lit) {
+			return []interface{}{x}
+		}
+	}
+	return nil
+}
+
+// compare reports whether "x op lit" holds.  Numbers are compared
+// numerically; strings and symbols by their text.
+func compare(x interface{}, op string, lit interface{}) bool {
+	var cmp int
+	switch lit := lit.(type) {
+	case nil:
+		cmp = 1
+		if x == nil {
+			cmp = 0
+		}
+	case float64:
+		var f float64
+		switch x := x.(type) {
+		case int64:
+			f = float64(x)
+		case float64:
+			f = x
+		default:
+			return false
+		}
+		switch {
+		case f < lit:
+			cmp = -1
+		case f > lit:
+			cmp = +1
+		}
+	case string:
+		if _, ok := x.([]interface{}); ok || x == nil {
+			return false
+		}
+		cmp = strings.Compare(text(x), lit)
+	}
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// text returns the text of a string, symbol or number.
+func text(x interface{}) string {
+	switch x := x.(type) {
+	case string:
+		return x
+	case sexpr.Symbol:
+		return string(x)
+	}
+	return fmt.Sprint(x)
+}
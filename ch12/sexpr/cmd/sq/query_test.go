@@ -0,0 +1,69 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const movies = `
+((Title "Dr. Strangelove") (Year 1964)
+ (Actor (("Dr. Strangelove" "Peter Sellers") ("Grace" "Tracy Reed")))
+ (Oscars ("Best Actor (Nomin.)" "Best Director (Nomin.)")))
+((Title "Casablanca") (Year 1942) (Actor ()) (Oscars ("Best Picture")))
+`
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`.Title`, `"Dr. Strangelove"
+"Casablanca"
+`},
+		{`.Actor[Grace] .Oscars[0]`, `"Tracy Reed"
+"Best Actor (Nomin.)"
+"Best Picture"
+`},
+		{`.Actor["Dr. Strangelove"],.Year`, `"Peter Sellers"
+1964
+1942
+`},
+		{`?(.Year < 1950){Title,Year}`, `((Title "Casablanca") (Year 1942))
+`},
+		{`?(.Oscars[] = "Best Picture").Title`, `"Casablanca"
+`},
+		{`.Oscars[]`, `"Best Actor (Nomin.)"
+"Best Director (Nomin.)"
+"Best Picture"
+`},
+		{`.Oscars[5] .Missing`, ``},
+		{`.`, movies[1:]},
+		{`.Oscars.[1]`, `"Best Director (Nomin.)"
+`},
+	}
+	for _, test := range tests {
+		q, err := parse(test.query)
+		if err != nil {
+			t.Errorf("parse(%q): %v", test.query, err)
+			continue
+		}
+		var out bytes.Buffer
+		if err := run(&out, q, strings.NewReader(movies)); err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if got := out.String(); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.query, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{`.Actor[`, `?(.Year ~ 1)`, `{Title`, `]`} {
+		if _, err := parse(bad); err == nil {
+			t.Errorf("parse(%q) succeeded, want error", bad)
+		}
+	}
+}
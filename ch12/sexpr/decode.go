@@ -10,6 +10,7 @@ package sexpr
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"text/scanner"
@@ -28,16 +29,48 @@ func Unmarshal(data []byte, out interface{}) (err error) {
 			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
 		}
 	}()
-	read(lex, reflect.ValueOf(out).Elem())
+	decodeValue(lex, reflect.ValueOf(out).Elem())
 	return nil
 }
 
 //!-Unmarshal
 
+// A Decoder reads a sequence of S-expressions from an input stream.
+type Decoder struct {
+	lex *lexer
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
+	lex.scan.Init(r)
+	lex.next() // get the first token
+	return &Decoder{lex}
+}
+
+// Decode reads the next S-expression from its input and populates
+// the variable whose address is in the non-nil pointer out.
+// It returns io.EOF at the end of the input.
+func (dec *Decoder) Decode(out interface{}) (err error) {
+	lex := dec.lex
+	if lex.token == scanner.EOF {
+		return io.EOF
+	}
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
+		}
+	}()
+	lex.labels = nil // labels are local to one S-expression
+	decodeValue(lex, reflect.ValueOf(out).Elem())
+	return nil
+}
+
 //!+lexer
 type lexer struct {
-	scan  scanner.Scanner
-	token rune // the current token
+	scan   scanner.Scanner
+	token  rune                  // the current token
+	labels map[int]reflect.Value // pointers defined by #n= labels
 }
 
 func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
@@ -59,52 +92,170 @@ func (lex *lexer) consume(want rune) {
 // The parser assumes
 // - that the S-expression input is well-formed; it does no error checking.
 // - that the S-expression input corresponds to the type of the variable.
-// - that all numbers in the input are non-negative decimal integers.
+// - that all numbers in the input are decimal.
 // - that all keys in ((key value) ...) struct syntax are unquoted symbols.
 // - that the input does not contain dotted lists such as (1 2 . 3).
-// - that the input does not contain Lisp reader macros such 'x and #'x.
+// - that the input does not contain Lisp reader macros such 'x and #'x,
+//   other than the datum labels #n= and #n# written by MarshalShared
+//   and vectors #(item ...), which are read like lists.
 //
 // The reflection logic assumes
 // - that v is always a variable of the appropriate type for the
 //   S-expression value.  For example, v must not be a boolean,
-//   interface, channel, or function, and if v is an array, the input
-//   must have the correct number of elements.
+//   non-empty interface, channel, or function, and if v is an array,
+//   the input must have the correct number of elements.
 // - that v in the top-level call to read has the zero value of its
 //   type and doesn't need clearing.
-// - that if v is a numeric variable, it is a signed integer.
+// - that if v is a numeric variable, it is not complex.
+//
+// Unmarshal and Decode use the faster, cached decoders of cache.go,
+// which produce the same results; read is the reference implementation.
 
 //!+read
 func read(lex *lexer, v reflect.Value) {
+	if v.Kind() == reflect.Ptr && lex.token != '#' &&
+		!(lex.token == scanner.Ident && lex.text() == "nil") {
+		// A pointer is written as the value it points to.
+		v.Set(reflect.New(v.Type().Elem()))
+		read(lex, v.Elem())
+		return
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 && lex.token != '#' {
+		// An empty interface holds a generic value; see readAny.
+		if x := readAny(lex); x != nil {
+			v.Set(reflect.ValueOf(x))
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return
+	}
 	switch lex.token {
 	case scanner.Ident:
-		// The only valid identifiers are
-		// "nil" and struct field names.
+		// The only valid identifiers are "nil",
+		// struct field names, and Symbols.
 		if lex.text() == "nil" {
 			v.Set(reflect.Zero(v.Type()))
 			lex.next()
 			return
 		}
+		if v.Type() == symbolType {
+			v.SetString(lex.text())
+			lex.next()
+			return
+		}
 	case scanner.String:
 		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
 		v.SetString(s)
 		lex.next()
 		return
-	case scanner.Int:
-		i, _ := strconv.Atoi(lex.text()) // NOTE: ignoring errors
-		v.SetInt(int64(i))
-		lex.next()
+	case scanner.Int, scanner.Float, '-':
+		readNumber(lex, v)
 		return
 	case '(':
 		lex.next()
 		readList(lex, v)
 		lex.next() // consume ')'
 		return
+	case '#':
+		lex.next()
+		if lex.token == '(' { // #(item ...) is a vector
+			read(lex, v)
+			return
+		}
+		readLabel(lex, v)
+		return
 	}
 	panic(fmt.Sprintf("unexpected token %q", lex.text()))
 }
 
 //!-read
 
+// readNumber reads an optionally negated integer or floating-point
+// literal into the numeric variable v.
+func readNumber(lex *lexer, v reflect.Value) {
+	neg := lex.token == '-'
+	if neg {
+		lex.next()
+	}
+	text := lex.text()
+	if neg {
+		text = "-" + text
+	}
+	switch lex.token {
+	case scanner.Int:
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16,
+			reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			u, _ := strconv.ParseUint(text, 10, 64) // NOTE: ignoring errors
+			v.SetUint(u)
+		case reflect.Float32, reflect.Float64:
+			f, _ := strconv.ParseFloat(text, 64) // NOTE: ignoring errors
+			v.SetFloat(f)
+		default:
+			i, _ := strconv.ParseInt(text, 10, 64) // NOTE: ignoring errors
+			v.SetInt(i)
+		}
+	case scanner.Float:
+		f, _ := strconv.ParseFloat(text, 64) // NOTE: ignoring errors
+		v.SetFloat(f)
+	default:
+		panic(fmt.Sprintf("got token %q, want number", lex.text()))
+	}
+	lex.next()
+}
+
+// readLabel reads the remainder of a datum label, #n=value or #n#,
+// into the pointer or empty interface variable v.
+func readLabel(lex *lexer, v reflect.Value) {
+	if lex.token != scanner.Int {
+		panic(fmt.Sprintf("got token %q, want label number", lex.text()))
+	}
+	n, _ := strconv.Atoi(lex.text()) // NOTE: ignoring errors
+	lex.next()
+	if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("datum label #%d on non-pointer %v", n, v.Type()))
+	}
+	switch lex.token {
+	case '=': // #n=value
+		lex.next()
+		if lex.labels == nil {
+			lex.labels = make(map[int]reflect.Value)
+		}
+		if v.Kind() == reflect.Interface {
+			// A generic value has no pointer to share,
+			// so references to it are copies.
+			p := reflect.New(v.Type())
+			lex.labels[n] = p
+			read(lex, p.Elem())
+			v.Set(p.Elem())
+			return
+		}
+		p := reflect.New(v.Type().Elem())
+		lex.labels[n] = p // define before reading, for cycles
+		v.Set(p)
+		read(lex, p.Elem())
+	case '#': // #n#
+		lex.next()
+		p, ok := lex.labels[n]
+		if !ok {
+			panic(fmt.Sprintf("undefined datum label #%d#", n))
+		}
+		switch {
+		case p.Elem().Kind() == reflect.Interface &&
+			p.Elem().Type().AssignableTo(v.Type()):
+			v.Set(p.Elem())
+		case p.Type().AssignableTo(v.Type()):
+			v.Set(p)
+		default:
+			panic(fmt.Sprintf("datum label #%d# is %v, want %v",
+				n, p.Type(), v.Type()))
+		}
+	default:
+		panic(fmt.Sprintf("got token %q after datum label, want = or #",
+			lex.text()))
+	}
+}
+
 //!+readlist
 func readList(lex *lexer, v reflect.Value) {
 	switch v.Kind() {
@@ -128,7 +279,7 @@ func readList(lex *lexer, v reflect.Value) {
 			}
 			name := lex.text()
 			lex.next()
-			read(lex, v.FieldByName(name))
+			read(lex, fieldByName(v, name))
 			lex.consume(')')
 		}
 
@@ -9,23 +9,32 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 //!+Marshal
 // Marshal encodes a Go value in S-expression form.
 func Marshal(v interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return encodeValue(reflect.ValueOf(v), &state{})
 }
 
 //!-Marshal
 
+// MarshalShared is like Marshal but writes each pointer that is
+// reached more than once using #n= and #n# datum labels, so that
+// shared and cyclic structures are encoded exactly once.
+func MarshalShared(v interface{}) ([]byte, error) {
+	return MarshalOptions{Shared: true}.Marshal(v)
+}
+
 // encode writes to buf an S-expression representation of v.
+// The settings in s control map order and datum labels.
+//
+// Marshal uses the faster, cached encoders of cache.go, which
+// produce the same output; encode is the reference implementation.
 //!+encode
-func encode(buf *bytes.Buffer, v reflect.Value) error {
+func encode(buf *bytes.Buffer, v reflect.Value, s *state) error {
 	switch v.Kind() {
 	case reflect.Invalid:
 		buf.WriteString("nil")
@@ -38,11 +47,26 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		fmt.Fprintf(buf, "%d", v.Uint())
 
+	case reflect.Float32, reflect.Float64:
+		buf.WriteString(formatFloat(v))
+
 	case reflect.String:
-		fmt.Fprintf(buf, "%q", v.String())
+		if v.Type() == symbolType {
+			buf.WriteString(v.String())
+		} else {
+			fmt.Fprintf(buf, "%q", v.String())
+		}
+
+	case reflect.Interface:
+		return encode(buf, v.Elem(), s)
 
 	case reflect.Ptr:
-		return encode(buf, v.Elem())
+		label, done := s.labels.mark(v)
+		buf.WriteString(label)
+		if done {
+			return nil
+		}
+		return encode(buf, v.Elem(), s)
 
 	case reflect.Array, reflect.Slice: // (value ...)
 		buf.WriteByte('(')
@@ -50,7 +74,7 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
-			if err := encode(buf, v.Index(i)); err != nil {
+			if err := encode(buf, v.Index(i), s); err != nil {
 				return err
 			}
 		}
@@ -63,7 +87,7 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 				buf.WriteByte(' ')
 			}
 			fmt.Fprintf(buf, "(%s ", v.Type().Field(i).Name)
-			if err := encode(buf, v.Field(i)); err != nil {
+			if err := encode(buf, v.Field(i), s); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
@@ -72,26 +96,36 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 
 	case reflect.Map: // ((key value) ...)
 		buf.WriteByte('(')
-		for i, key := range v.MapKeys() {
+		for i, key := range s.mapKeys(v) {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
 			buf.WriteByte('(')
-			if err := encode(buf, key); err != nil {
+			if err := encode(buf, key, s); err != nil {
 				return err
 			}
 			buf.WriteByte(' ')
-			if err := encode(buf, v.MapIndex(key)); err != nil {
+			if err := encode(buf, v.MapIndex(key), s); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
 		}
 		buf.WriteByte(')')
 
-	default: // float, complex, bool, chan, func, interface
+	default: // complex, bool, chan, func
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
 }
 
 //!-encode
+
+// formatFloat formats the floating-point value v so that it reads
+// back as a float, not an integer.
+func formatFloat(v reflect.Value) string {
+	s := strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"text/scanner"
+)
+
+// A Symbol is an unquoted identifier such as a struct field name.
+// It is written without quotation marks.
+type Symbol string
+
+var symbolType = reflect.TypeOf(Symbol(""))
+
+// readAny reads an S-expression of unknown type and returns it as a
+// generic value, in the manner of encoding/json:
+//
+//	nil         nil
+//	identifier  Symbol
+//	"string"    string
+//	integer     int64
+//	float       float64
+//	(list ...)  []interface{}
+func readAny(lex *lexer) interface{} {
+	switch lex.token {
+	case scanner.Ident:
+		text := lex.text()
+		lex.next()
+		if text == "nil" {
+			return nil
+		}
+		return Symbol(text)
+	case scanner.String:
+		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
+		lex.next()
+		return s
+	case scanner.Int, scanner.Float, '-':
+		neg := lex.token == '-'
+		if neg {
+			lex.next()
+		}
+		if lex.token == scanner.Float {
+			var f float64
+			readNumber(lex, reflect.ValueOf(&f).Elem())
+			if neg {
+				f = -f
+			}
+			return f
+		}
+		var i int64
+		readNumber(lex, reflect.ValueOf(&i).Elem())
+		if neg {
+			i = -i
+		}
+		return i
+	case '(':
+		lex.next()
+		list := []interface{}{}
+		for !endList(lex) {
+			list = append(list, readAny(lex))
+		}
+		lex.next() // consume ')'
+		return list
+	case '#':
+		var x interface{}
+		lex.next()
+		if lex.token == '(' { // #(item ...) is a vector
+			return readAny(lex)
+		}
+		readLabel(lex, reflect.ValueOf(&x).Elem())
+		return x
+	}
+	panic(fmt.Sprintf("unexpected token %q", lex.text()))
+}
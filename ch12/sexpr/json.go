@@ -0,0 +1,350 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+// This file converts between JSON and S-expressions using this
+// mapping:
+//
+// 	JSON              S-expression
+// 	null              nil
+// 	true, false       the symbols true and false
+// 	number            number, with the same text
+// 	"string"          "string"
+// 	[a, b]            (a b)
+// 	{"k": v, ...}     ((k v) ...)
+//
+// An object key is written as a symbol if it is an identifier other
+// than nil, true or false, and as a string otherwise.
+//
+// A list is read as an object if every element is a pair whose head
+// is a symbol or string, as in the output of Marshal for a struct or
+// a map with string keys, and as an array otherwise.  A JSON array
+// whose first element is an array beginning with a string or boolean,
+// such as [["a", 1]], is therefore written as the vector #(("a" 1)),
+// which is always read as an array.
+//
+// With these rules, every JSON value survives a round trip through
+// FromJSON and ToJSON except the empty object {}, which is written as
+// () and read back as the empty array [].  S-expression symbols other
+// than true and false become JSON strings, and datum labels are not
+// supported.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+)
+
+// ToJSON reads a sequence of S-expressions from r and writes each
+// one to w as compact JSON on a line of its own.
+func ToJSON(w io.Writer, r io.Reader) error {
+	c := &toJSON{dec: NewDecoder(r), w: bufio.NewWriter(w)}
+	for {
+		tok, err := c.dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		x, err := c.read(tok)
+		if err != nil {
+			return err
+		}
+		if err := c.value(x); err != nil {
+			return err
+		}
+		c.w.WriteByte('\n')
+	}
+	return c.w.Flush()
+}
+
+type toJSON struct {
+	dec *Decoder
+	w   *bufio.Writer
+}
+
+// A jsonList is a list or vector read by ToJSON.  Whether it is
+// written as an array or an object depends on all its elements,
+// so ToJSON reads each S-expression whole before writing it.
+type jsonList struct {
+	vector bool
+	elems  []interface{} // atom Tokens and *jsonLists
+}
+
+// read returns the S-expression that begins with tok: the token
+// itself if it is an atom, or else the *jsonList it opens.
+func (c *toJSON) read(tok Token) (interface{}, error) {
+	d, ok := tok.(Delim)
+	if !ok {
+		return tok, nil
+	}
+	if d == ')' {
+		return nil, c.dec.errorf("unexpected ')'")
+	}
+	l := &jsonList{vector: d == '#'}
+	for {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == Delim(')') {
+			return l, nil
+		}
+		x, err := c.read(tok)
+		if err != nil {
+			return nil, err
+		}
+		l.elems = append(l.elems, x)
+	}
+}
+
+// isObject reports whether l is written as an object: a non-empty
+// list, not a vector, of (key value) pairs whose keys are symbols
+// or strings.
+func (l *jsonList) isObject() bool {
+	if l.vector || len(l.elems) == 0 {
+		return false
+	}
+	for _, x := range l.elems {
+		pair, ok := x.(*jsonList)
+		if !ok || pair.vector || len(pair.elems) != 2 {
+			return false
+		}
+		if _, ok := jsonKey(pair.elems[0]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// value writes x, an S-expression returned by read, as JSON.
+func (c *toJSON) value(x interface{}) error {
+	switch x := x.(type) {
+	case nil:
+		c.w.WriteString("null")
+	case Symbol:
+		if x == "true" || x == "false" {
+			c.w.WriteString(string(x))
+		} else {
+			c.string(string(x))
+		}
+	case string:
+		c.string(x)
+	case Number:
+		return c.number(x)
+	case *jsonList:
+		if x.isObject() {
+			c.w.WriteByte('{')
+			for i, pair := range x.elems {
+				if i > 0 {
+					c.w.WriteByte(',')
+				}
+				pair := pair.(*jsonList)
+				key, _ := jsonKey(pair.elems[0])
+				c.string(key)
+				c.w.WriteByte(':')
+				if err := c.value(pair.elems[1]); err != nil {
+					return err
+				}
+			}
+			c.w.WriteByte('}')
+			return nil
+		}
+		c.w.WriteByte('[')
+		for i, elem := range x.elems {
+			if i > 0 {
+				c.w.WriteByte(',')
+			}
+			if err := c.value(elem); err != nil {
+				return err
+			}
+		}
+		c.w.WriteByte(']')
+	}
+	return nil
+}
+
+func (c *toJSON) string(s string) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s) // can't fail
+	c.w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// number writes the numeric literal n, converting Go-only syntax
+// such as hexadecimal or a leading '.' to JSON.
+func (c *toJSON) number(n Number) error {
+	if json.Valid([]byte(n)) {
+		c.w.WriteString(string(n))
+		return nil
+	}
+	if i, err := strconv.ParseInt(string(n), 0, 64); err == nil {
+		c.w.WriteString(strconv.FormatInt(i, 10))
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return c.dec.errorf("invalid number %s", n)
+	}
+	c.w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	return nil
+}
+
+// jsonKey reports whether x, the head of a pair, is an object key.
+func jsonKey(x interface{}) (string, bool) {
+	switch x := x.(type) {
+	case Symbol:
+		return string(x), true
+	case string:
+		return x, true
+	}
+	return "", false
+}
+
+// FromJSON reads a sequence of JSON values from r and writes each
+// one to w as a compact S-expression on a line of its own.
+func FromJSON(w io.Writer, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	c := &fromJSON{dec: dec, w: bufio.NewWriter(w)}
+	for {
+		tok, err := c.token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := c.value(tok); err != nil {
+			return err
+		}
+		c.w.WriteByte('\n')
+	}
+	return c.w.Flush()
+}
+
+type fromJSON struct {
+	dec    *json.Decoder
+	w      *bufio.Writer
+	peeked []json.Token // tokens read ahead
+}
+
+func (c *fromJSON) token() (json.Token, error) {
+	if len(c.peeked) > 0 {
+		tok := c.peeked[0]
+		c.peeked = c.peeked[1:]
+		return tok, nil
+	}
+	return c.dec.Token()
+}
+
+func (c *fromJSON) value(tok json.Token) error {
+	switch tok := tok.(type) {
+	case nil:
+		c.w.WriteString("nil")
+	case bool:
+		c.w.WriteString(strconv.FormatBool(tok))
+	case json.Number:
+		c.w.WriteString(string(tok))
+	case string:
+		c.w.WriteString(strconv.Quote(tok))
+	case json.Delim:
+		switch tok {
+		case '[':
+			return c.array()
+		case '{':
+			return c.object()
+		}
+		return fmt.Errorf("unexpected %v", tok)
+	}
+	return nil
+}
+
+func (c *fromJSON) array() error {
+	// Look ahead to see whether the list form would be read
+	// back as an object; if so, write a vector instead.
+	first, err := c.token()
+	if err != nil {
+		return err
+	}
+	c.peeked = append(c.peeked, first)
+	open := "("
+	if first == json.Delim('[') {
+		head, err := c.dec.Token()
+		if err != nil {
+			return err
+		}
+		c.peeked = append(c.peeked, head)
+		switch head.(type) {
+		case string, bool:
+			open = "#("
+		}
+	}
+
+	c.w.WriteString(open)
+	for i := 0; ; i++ {
+		tok, err := c.token()
+		if err != nil {
+			return err
+		}
+		if tok == json.Delim(']') {
+			break
+		}
+		if i > 0 {
+			c.w.WriteByte(' ')
+		}
+		if err := c.value(tok); err != nil {
+			return err
+		}
+	}
+	c.w.WriteByte(')')
+	return nil
+}
+
+func (c *fromJSON) object() error {
+	c.w.WriteByte('(')
+	for i := 0; ; i++ {
+		tok, err := c.token()
+		if err != nil {
+			return err
+		}
+		if tok == json.Delim('}') {
+			break
+		}
+		if i > 0 {
+			c.w.WriteByte(' ')
+		}
+		c.w.WriteByte('(')
+		c.w.WriteString(sexprKey(tok.(string))) // keys are always strings
+		c.w.WriteByte(' ')
+		if tok, err = c.token(); err != nil {
+			return err
+		}
+		if err := c.value(tok); err != nil {
+			return err
+		}
+		c.w.WriteByte(')')
+	}
+	c.w.WriteByte(')')
+	return nil
+}
+
+// sexprKey returns the S-expression form of an object key:
+// a symbol if possible, or a quoted string.
+func sexprKey(k string) string {
+	switch k {
+	case "", "nil", "true", "false":
+		return strconv.Quote(k)
+	}
+	for i, r := range k {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return strconv.Quote(k)
+		}
+	}
+	return k
+}
@@ -0,0 +1,92 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+// This file implements Common Lisp-style datum labels.  A pointer
+// that is reached more than once is written as #n=value the first
+// time and as #n# thereafter, so that shared structure and cycles
+// survive a round trip through Marshal and Unmarshal.
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// A ptrKey identifies a pointer.  The type is needed because a
+// pointer to a struct and a pointer to its first field are equal
+// as addresses.
+type ptrKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// A labeler decides which pointers need datum labels.
+// A nil *labeler labels nothing.
+type labeler struct {
+	count map[ptrKey]int // number of references to each pointer
+	label map[ptrKey]int // label of each pointer already written
+}
+
+// newLabeler walks v and counts the references to each pointer.
+func newLabeler(v reflect.Value) *labeler {
+	l := &labeler{
+		count: make(map[ptrKey]int),
+		label: make(map[ptrKey]int),
+	}
+	l.walk(v)
+	return l
+}
+
+func (l *labeler) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		k := ptrKey{v.Pointer(), v.Type()}
+		l.count[k]++
+		if l.count[k] > 1 {
+			return // already visited
+		}
+		l.walk(v.Elem())
+
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			l.walk(v.Index(i))
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			l.walk(v.Field(i))
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			l.walk(key)
+			l.walk(v.MapIndex(key))
+		}
+
+	case reflect.Interface:
+		l.walk(v.Elem())
+	}
+}
+
+// mark returns the label, if any, to write before the pointer v.
+// If done is true, the pointee has already been written and the
+// caller must not write it again.
+func (l *labeler) mark(v reflect.Value) (label string, done bool) {
+	if l == nil || v.IsNil() {
+		return "", false
+	}
+	k := ptrKey{v.Pointer(), v.Type()}
+	if l.count[k] < 2 {
+		return "", false // not shared
+	}
+	if n, ok := l.label[k]; ok {
+		return "#" + strconv.Itoa(n) + "#", true
+	}
+	n := len(l.label) + 1
+	l.label[k] = n
+	return "#" + strconv.Itoa(n) + "=", false
+}
@@ -0,0 +1,89 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// MarshalOptions configures the layout of an S-expression encoding.
+// The zero value produces the same output as Marshal.
+type MarshalOptions struct {
+	Pretty          bool // break long lists across lines; otherwise compact
+	Width           int  // line width when Pretty; 0 means 80 columns
+	Indent          int  // indent per level when Pretty; 0 aligns with '('
+	SortKeys        bool // write map entries in increasing key order
+	Shared          bool // write shared pointers with #n= and #n# labels
+	TrailingNewline bool // end the output with a newline
+}
+
+// Marshal encodes a Go value in S-expression form according to o.
+func (o MarshalOptions) Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	s := &state{sortKeys: o.SortKeys}
+	if o.Shared {
+		s.labels = newLabeler(rv)
+	}
+
+	var data []byte
+	if o.Pretty {
+		p := newPrinter(o.Width, o.Indent, s)
+		if err := pretty(p, rv); err != nil {
+			return nil, err
+		}
+		data = p.Bytes()
+	} else {
+		var err error
+		if data, err = encodeValue(rv, s); err != nil {
+			return nil, err
+		}
+	}
+	if o.TrailingNewline {
+		data = append(data, '\n')
+	}
+	return data, nil
+}
+
+// A state holds the settings of one call to Marshal that both
+// encode and pretty consult.
+type state struct {
+	labels   *labeler // non-nil if shared pointers are labeled
+	sortKeys bool
+}
+
+// mapKeys returns the keys of the map v, sorted if s.sortKeys is set.
+// Keys of basic types are compared by value; others by their encoding.
+func (s *state) mapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	if !s.sortKeys {
+		return keys
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+	return keys
+}
+
+func keyLess(x, y reflect.Value) bool {
+	switch x.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return x.Int() < y.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() < y.Uint()
+	case reflect.Float32, reflect.Float64:
+		return x.Float() < y.Float()
+	case reflect.String:
+		return x.String() < y.String()
+	case reflect.Bool:
+		return !x.Bool() && y.Bool()
+	}
+	var bx, by bytes.Buffer
+	encode(&bx, x, &state{sortKeys: true}) // NOTE: ignoring errors
+	encode(&by, y, &state{sortKeys: true})
+	return bytes.Compare(bx.Bytes(), by.Bytes()) < 0
+}
@@ -10,17 +10,16 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"strconv"
 )
 
+// MarshalIndent is like Marshal but breaks lists across lines
+// so that the output fits within an 80-column margin.
 func MarshalIndent(v interface{}) ([]byte, error) {
-	p := printer{width: margin}
-	if err := pretty(&p, reflect.ValueOf(v)); err != nil {
-		return nil, err
-	}
-	return p.Bytes(), nil
+	return MarshalOptions{Pretty: true}.Marshal(v)
 }
 
-const margin = 80
+const margin = 80 // default line width
 
 type token struct {
 	kind rune // one of "s ()" (string, blank, start, end)
@@ -36,6 +35,16 @@ type printer struct {
 	bytes.Buffer
 	indents []int
 	width   int // remaining space
+	margin  int // line width
+	indent  int // indent per level, or 0 to align with '('
+	*state
+}
+
+func newPrinter(width, indent int, s *state) *printer {
+	if width <= 0 {
+		width = margin
+	}
+	return &printer{width: width, margin: width, indent: indent, state: s}
 }
 
 func (p *printer) string(str string) {
@@ -94,22 +103,24 @@ func (p *printer) print(t *token) {
 		p.WriteString(t.str)
 		p.width -= len(t.str)
 	case '(':
-		p.indents = append(p.indents, p.width)
+		// Push the remaining space of a line broken within this list.
+		if p.indent > 0 {
+			p.indents = append(p.indents, p.margin-p.indent*(len(p.indents)+1))
+		} else {
+			p.indents = append(p.indents, p.width-1) // just after '('
+		}
 	case ')':
 		p.indents = p.indents[:len(p.indents)-1] // pop
 	case ' ':
 		if t.size > p.width {
-			p.width = p.indents[len(p.indents)-1] - 1
-			fmt.Fprintf(&p.Buffer, "\n%*s", margin-p.width, "")
+			p.width = p.indents[len(p.indents)-1]
+			fmt.Fprintf(&p.Buffer, "\n%*s", p.margin-p.width, "")
 		} else {
 			p.WriteByte(' ')
 			p.width--
 		}
 	}
 }
-func (p *printer) stringf(format string, args ...interface{}) {
-	p.string(fmt.Sprintf(format, args...))
-}
 
 func pretty(p *printer, v reflect.Value) error {
 	switch v.Kind() {
@@ -118,14 +129,24 @@ func pretty(p *printer, v reflect.Value) error {
 
 	case reflect.Int, reflect.Int8, reflect.Int16,
 		reflect.Int32, reflect.Int64:
-		p.stringf("%d", v.Int())
+		p.string(strconv.FormatInt(v.Int(), 10))
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		p.stringf("%d", v.Uint())
+		p.string(strconv.FormatUint(v.Uint(), 10))
+
+	case reflect.Float32, reflect.Float64:
+		p.string(formatFloat(v))
 
 	case reflect.String:
-		p.stringf("%q", v.String())
+		if v.Type() == symbolType {
+			p.string(v.String())
+		} else {
+			p.string(strconv.Quote(v.String()))
+		}
+
+	case reflect.Interface:
+		return pretty(p, v.Elem())
 
 	case reflect.Array, reflect.Slice: // (value ...)
 		p.begin()
@@ -141,12 +162,12 @@ func pretty(p *printer, v reflect.Value) error {
 
 	case reflect.Struct: // ((name value ...)
 		p.begin()
-		for i := 0; i < v.NumField(); i++ {
+		for i, f := range cachedFields(v.Type()) {
 			if i > 0 {
 				p.space()
 			}
 			p.begin()
-			p.string(v.Type().Field(i).Name)
+			p.string(f.name)
 			p.space()
 			if err := pretty(p, v.Field(i)); err != nil {
 				return err
@@ -157,7 +178,7 @@ func pretty(p *printer, v reflect.Value) error {
 
 	case reflect.Map: // ((key value ...)
 		p.begin()
-		for i, key := range v.MapKeys() {
+		for i, key := range p.mapKeys(v) {
 			if i > 0 {
 				p.space()
 			}
@@ -174,9 +195,16 @@ func pretty(p *printer, v reflect.Value) error {
 		p.end()
 
 	case reflect.Ptr:
+		label, done := p.labels.mark(v)
+		if label != "" {
+			p.string(label)
+		}
+		if done {
+			return nil
+		}
 		return pretty(p, v.Elem())
 
-	default: // float, complex, bool, chan, func, interface
+	default: // complex, bool, chan, func
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
@@ -4,7 +4,11 @@
 package sexpr
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -72,3 +76,237 @@ func Test(t *testing.T) {
 	}
 	t.Logf("MarshalIdent() = %s\n", data)
 }
+
+// TestShared verifies that MarshalShared writes shared and cyclic
+// pointers with datum labels and that Unmarshal restores the aliasing.
+func TestShared(t *testing.T) {
+	type Node struct {
+		Name string
+		Next *Node
+	}
+
+	// A list whose tail points back to its head.
+	a := &Node{Name: "a"}
+	a.Next = &Node{Name: "b", Next: a}
+	data, err := MarshalShared(a)
+	if err != nil {
+		t.Fatalf("MarshalShared failed: %v", err)
+	}
+	const want = `#1=((Name "a") (Next ((Name "b") (Next #1#))))`
+	if string(data) != want {
+		t.Errorf("MarshalShared() = %s, want %s", data, want)
+	}
+	var head *Node
+	if err := Unmarshal(data, &head); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if head.Name != "a" || head.Next.Name != "b" || head.Next.Next != head {
+		t.Errorf("Unmarshal(%s) did not restore the cycle", data)
+	}
+
+	// Two fields that share a subtree.
+	type Pair struct{ X, Y *Node }
+	shared := &Node{Name: "shared"}
+	data, err = MarshalShared(Pair{shared, shared})
+	if err != nil {
+		t.Fatalf("MarshalShared failed: %v", err)
+	}
+	const wantPair = `((X #1=((Name "shared") (Next nil))) (Y #1#))`
+	if string(data) != wantPair {
+		t.Errorf("MarshalShared() = %s, want %s", data, wantPair)
+	}
+	var pair Pair
+	if err := Unmarshal(data, &pair); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if pair.X == nil || pair.X != pair.Y || pair.X.Name != "shared" {
+		t.Errorf("Unmarshal(%s) = %+v, want X == Y", data, pair)
+	}
+
+	// Without labels, the shared subtree is written twice.
+	data, err = Marshal(Pair{shared, shared})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	const wantDup = `((X ((Name "shared") (Next nil))) (Y ((Name "shared") (Next nil))))`
+	if string(data) != wantDup {
+		t.Errorf("Marshal() = %s, want %s", data, wantDup)
+	}
+
+	// References to undefined labels are errors.
+	if err := Unmarshal([]byte(`#2#`), &head); err == nil {
+		t.Error("Unmarshal(#2#) succeeded, want error")
+	}
+}
+
+// TestMarshalOptions verifies the layout settings of MarshalOptions
+// and that sorted map output is the same on every run.
+func TestMarshalOptions(t *testing.T) {
+	type Movie struct {
+		Title  string
+		Year   int
+		Actor  map[string]string
+		Oscars []string
+	}
+	strangelove := Movie{
+		Title: "Dr. Strangelove",
+		Year:  1964,
+		Actor: map[string]string{
+			"Dr. Strangelove":           "Peter Sellers",
+			"Gen. Buck Turgidson":       "George C. Scott",
+			"Brig. Gen. Jack D. Ripper": "Sterling Hayden",
+		},
+		Oscars: []string{"Best Actor (Nomin.)", "Best Director (Nomin.)"},
+	}
+	tests := []struct {
+		opts MarshalOptions
+		want string
+	}{
+		{MarshalOptions{SortKeys: true},
+			`((Title "Dr. Strangelove") (Year 1964) (Actor (("Brig. Gen. Jack D. Ripper" "Sterling Hayden") ("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott"))) (Oscars ("Best Actor (Nomin.)" "Best Director (Nomin.)")))`},
+		{MarshalOptions{SortKeys: true, Pretty: true, Width: 40}, `((Title "Dr. Strangelove") (Year 1964)
+ (Actor
+  (("Brig. Gen. Jack D. Ripper"
+    "Sterling Hayden")
+   ("Dr. Strangelove" "Peter Sellers")
+   ("Gen. Buck Turgidson"
+    "George C. Scott")))
+ (Oscars
+  ("Best Actor (Nomin.)"
+   "Best Director (Nomin.)")))`},
+		{MarshalOptions{SortKeys: true, Pretty: true, Width: 40, Indent: 2, TrailingNewline: true},
+			`((Title "Dr. Strangelove") (Year 1964)
+  (Actor
+    (("Brig. Gen. Jack D. Ripper"
+        "Sterling Hayden")
+      ("Dr. Strangelove"
+        "Peter Sellers")
+      ("Gen. Buck Turgidson"
+        "George C. Scott")))
+  (Oscars
+    ("Best Actor (Nomin.)"
+      "Best Director (Nomin.)")))
+`},
+	}
+	for _, test := range tests {
+		for i := 0; i < 10; i++ { // map iteration order varies
+			data, err := test.opts.Marshal(strangelove)
+			if err != nil {
+				t.Fatalf("%+v.Marshal failed: %v", test.opts, err)
+			}
+			if string(data) != test.want {
+				t.Fatalf("%+v.Marshal() = %s, want %s", test.opts, data, test.want)
+			}
+		}
+	}
+}
+
+// TestDecoder verifies that a Decoder reads a stream of documents
+// into generic values that encode back to the same text.
+func TestDecoder(t *testing.T) {
+	const input = `((Title "Casablanca") (Year 1942) (Rating -8.5) (Sequel nil))
+(1 (2 3) ())`
+	want := []interface{}{
+		[]interface{}{
+			[]interface{}{Symbol("Title"), "Casablanca"},
+			[]interface{}{Symbol("Year"), int64(1942)},
+			[]interface{}{Symbol("Rating"), -8.5},
+			[]interface{}{Symbol("Sequel"), nil},
+		},
+		[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{}},
+	}
+	dec := NewDecoder(strings.NewReader(input))
+	var got []interface{}
+	for {
+		var x interface{}
+		if err := dec.Decode(&x); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		got = append(got, x)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Decode() = %#v, want %#v", got, want)
+	}
+	data, err := Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := "(" + strings.Replace(input, "\n", " ", -1) + ")"; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
+
+// TestJSON verifies that JSON values survive a round trip through
+// FromJSON and ToJSON, and that Marshal output converts to JSON.
+func TestJSON(t *testing.T) {
+	for _, input := range []string{
+		`null`,
+		`[true,false,0,-1,2.5,-3e+20,1E5,"x\"y\\zé<>"]`,
+		`{"Title":"Casablanca","Year":1942,"Dr. X":null,"nil":[],"":{"a":[1]}}`,
+		`[["a",1],["b",2]]`,
+		`[[true]]`,
+		`[[1,"a"],[[]],[[["k",1]]]]`,
+		`{"pairs":[["a","b","c"]],"k":[{"x":1},{"y":[["z"]]}]}`,
+	} {
+		var sx, js bytes.Buffer
+		if err := FromJSON(&sx, strings.NewReader(input)); err != nil {
+			t.Errorf("FromJSON(%s): %v", input, err)
+			continue
+		}
+		if err := ToJSON(&js, bytes.NewReader(sx.Bytes())); err != nil {
+			t.Errorf("ToJSON(%s): %v", sx.Bytes(), err)
+			continue
+		}
+		if got := strings.TrimSuffix(js.String(), "\n"); got != input {
+			t.Errorf("round trip of %s via %s= %s", input, sx.Bytes(), got)
+		}
+	}
+
+	for _, test := range []struct{ input, want string }{
+		{`((Title "Casablanca") (Year 1942) (Oscars ("Best Picture")))`,
+			`{"Title":"Casablanca","Year":1942,"Oscars":["Best Picture"]}`},
+		{`(("a" "b" "c") ("d"))`, `[["a","b","c"],["d"]]`},
+		{`(0x1f .5 -7 sym ())`, `[31,0.5,-7,"sym",[]]`},
+		{`((a 1) (b (c 2)))`, `{"a":1,"b":["c",2]}`},
+		{`((a 1) 2)`, `[["a",1],2]`},
+		{`((a 1) (b))`, `[["a",1],["b"]]`},
+	} {
+		var js bytes.Buffer
+		if err := ToJSON(&js, strings.NewReader(test.input)); err != nil {
+			t.Errorf("ToJSON(%s): %v", test.input, err)
+			continue
+		}
+		if got := strings.TrimSuffix(js.String(), "\n"); got != test.want {
+			t.Errorf("ToJSON(%s) = %s, want %s", test.input, got, test.want)
+		}
+	}
+
+	// Marshal output converts to the JSON of the same value, even
+	// when a list begins with a pair but is not an object.
+	for _, v := range []interface{}{
+		[][]string{{"a", "b"}, {"c"}},
+		[]interface{}{[]interface{}{"a", 1}, 2},
+	} {
+		data, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := json.Marshal(v)
+		var js bytes.Buffer
+		if err := ToJSON(&js, bytes.NewReader(data)); err != nil {
+			t.Errorf("ToJSON(%s): %v", data, err)
+			continue
+		}
+		if got := strings.TrimSuffix(js.String(), "\n"); got != string(want) {
+			t.Errorf("ToJSON(%s) = %s, want %s", data, got, want)
+		}
+	}
+
+	for _, bad := range []string{`(`, `#1=(1)`, `)`, `(1 (2)`} {
+		if err := ToJSON(new(bytes.Buffer), strings.NewReader(bad)); err == nil {
+			t.Errorf("ToJSON(%s) succeeded, want error", bad)
+		}
+	}
+}
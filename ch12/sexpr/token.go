@@ -0,0 +1,87 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package sexpr
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/scanner"
+)
+
+// A Token holds a value of one of these types:
+//
+//	Delim   for the start and end of a list: ( )
+//	        or the start of a vector: #(
+//	Symbol  for identifiers other than nil
+//	string  for string literals
+//	Number  for numeric literals
+//	nil     for nil
+type Token interface{}
+
+// A Delim is a list delimiter: '(' or ')', or '#' for the
+// opening "#(" of a vector, which is closed by ')'.
+type Delim rune
+
+func (d Delim) String() string {
+	if d == '#' {
+		return "#("
+	}
+	return string(d)
+}
+
+// A Number is the text of a numeric literal, such as "-12" or "3.5e10".
+type Number string
+
+// Token returns the next S-expression token in the input stream.
+// At the end of the input, Token returns nil, io.EOF.
+// Datum labels are not supported and are reported as errors.
+func (dec *Decoder) Token() (Token, error) {
+	lex := dec.lex
+	tok, text := lex.token, lex.text()
+	switch tok {
+	case scanner.EOF:
+		return nil, io.EOF
+	case '(', ')':
+		lex.next()
+		return Delim(tok), nil
+	case '#':
+		lex.next()
+		if lex.token != '(' {
+			return nil, dec.errorf("datum labels are not supported by Token")
+		}
+		lex.next()
+		return Delim('#'), nil
+	case scanner.Ident:
+		lex.next()
+		if text == "nil" {
+			return nil, nil
+		}
+		return Symbol(text), nil
+	case scanner.String:
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, dec.errorf("%v", err)
+		}
+		lex.next()
+		return s, nil
+	case scanner.Int, scanner.Float:
+		lex.next()
+		return Number(text), nil
+	case '-':
+		lex.next()
+		if lex.token != scanner.Int && lex.token != scanner.Float {
+			return nil, dec.errorf("got %q, want number", lex.text())
+		}
+		text = "-" + lex.text()
+		lex.next()
+		return Number(text), nil
+	}
+	return nil, dec.errorf("unexpected token %q", text)
+}
+
+func (dec *Decoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("error at %s: %s",
+		dec.lex.scan.Position, fmt.Sprintf(format, args...))
+}
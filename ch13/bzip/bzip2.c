@@ -1,6 +1,8 @@
 // Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
 // License: https://creativecommons.org/licenses/by-nc-sa/4.0/
 
+//go:build cgo
+
 // See page 362.
 //
 // The version of this program that appeared in the first and second
@@ -30,3 +32,16 @@ int bz2compress(bz_stream *s, int action,
 }
 
 //!-
+
+int bz2decompress(bz_stream *s,
+                  char *in, unsigned *inlen, char *out, unsigned *outlen) {
+  s->next_in = in;
+  s->avail_in = *inlen;
+  s->next_out = out;
+  s->avail_out = *outlen;
+  int r = BZ2_bzDecompress(s);
+  *inlen -= s->avail_in;
+  *outlen -= s->avail_out;
+  s->next_in = s->next_out = NULL;
+  return r;
+}
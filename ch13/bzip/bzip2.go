@@ -1,6 +1,8 @@
 // Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
 // License: https://creativecommons.org/licenses/by-nc-sa/4.0/
 
+//go:build cgo
+
 // See page 362.
 //
 // The version of this program that appeared in the first and second
@@ -22,7 +24,8 @@
 
 //!+
 
-// Package bzip provides a writer that uses bzip2 compression (bzip.org).
+// Package bzip provides a writer that uses bzip2 compression (bzip.org),
+// and a reader that decompresses it.
 package bzip
 
 /*
@@ -39,31 +42,51 @@ import "C"
 
 import (
 	"io"
+	"sync"
 	"unsafe"
 )
 
 type writer struct {
-	w      io.Writer // underlying output stream
+	mu     sync.Mutex // guards the fields below
+	w      io.Writer  // underlying output stream
 	stream *C.bz_stream
 	outbuf [64 * 1024]byte
 }
 
 // NewWriter returns a writer for bzip2-compressed streams.
+// It is safe to call its methods concurrently.
 func NewWriter(out io.Writer) io.WriteCloser {
-	const blockSize = 9
+	w, err := NewWriterLevel(out, Options{})
+	if err != nil {
+		return errWriter{err}
+	}
+	return w
+}
+
+// NewWriterLevel is like NewWriter but compresses as opts specifies.
+func NewWriterLevel(out io.Writer, opts Options) (io.WriteCloser, error) {
+	blockSize, workFactor, err := opts.values()
+	if err != nil {
+		return nil, err
+	}
 	const verbosity = 0
-	const workFactor = 30
 	w := &writer{w: out, stream: C.bz2alloc()}
-	C.BZ2_bzCompressInit(w.stream, blockSize, verbosity, workFactor)
-	return w
+	code := C.BZ2_bzCompressInit(w.stream, C.int(blockSize), verbosity, C.int(workFactor))
+	if code != C.BZ_OK {
+		C.bz2free(w.stream)
+		return nil, bzError(code)
+	}
+	return w, nil
 }
 
 //!-
 
 //!+write
 func (w *writer) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if w.stream == nil {
-		panic("closed")
+		return 0, ErrClosed
 	}
 	var total int // uncompressed bytes written
 
@@ -87,8 +110,10 @@ func (w *writer) Write(data []byte) (int, error) {
 // Close flushes the compressed data and closes the stream.
 // It does not close the underlying io.Writer.
 func (w *writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if w.stream == nil {
-		panic("closed")
+		return ErrClosed
 	}
 	defer func() {
 		C.BZ2_bzCompressEnd(w.stream)
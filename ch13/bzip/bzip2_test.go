@@ -27,7 +27,8 @@ func TestBzip2(t *testing.T) {
 	}
 
 	// Check the size of the compressed stream.
-	if got, want := compressed.Len(), 255; got != want {
+	// The pure-Go compressor may differ slightly from libbzip2.
+	if got, want := compressed.Len(), 255; got != want && (libbzip2 || got > want+5) {
 		t.Errorf("1 million hellos compressed to %d bytes, want %d", got, want)
 	}
 
@@ -0,0 +1,9 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+//go:build cgo
+
+package bzip_test
+
+// libbzip2 reports whether the package uses libbzip2.
+const libbzip2 = true
@@ -0,0 +1,450 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+// This file is a bzip2 compressor in pure Go, for builds without cgo.
+// It follows the format that libbzip2 writes, but it takes no pains
+// to compress well: it uses a single Huffman table for each block.
+// The steps for each block are:
+//
+//	1. run-length encoding of runs of 4 to 255 equal bytes (RLE1),
+//	2. the Burrows-Wheeler transform (BWT),
+//	3. the move-to-front transform (MTF), with runs of zeros
+//	   encoded as the symbols RUNA and RUNB (RLE2),
+//	4. Huffman coding.
+
+// A goWriter is a writer for bzip2-compressed streams in pure Go.
+type goWriter struct {
+	mu     sync.Mutex // guards the fields below
+	bw     bitWriter
+	closed bool
+
+	max       int    // maximum size of a block after RLE1
+	block     []byte // the current block, after RLE1
+	blockCRC  uint32 // of the input of the current block
+	streamCRC uint32
+	run       byte // the byte in the current run
+	runLen    int  // the length of the current run, up to 255
+}
+
+func newGoWriter(out io.Writer, blockSize int) *goWriter {
+	w := &goWriter{
+		bw:       bitWriter{w: out},
+		max:      blockSize*100000 - 19, // as in libbzip2
+		blockCRC: 0xffffffff,
+	}
+	w.bw.writeBits(24, 'B'<<16|'Z'<<8|'h')
+	w.bw.writeBits(8, uint64('0'+blockSize))
+	return w
+}
+
+func (w *goWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	for i, b := range data {
+		if w.runLen > 0 && b == w.run && w.runLen < 255 {
+			w.runLen++
+		} else {
+			w.flushRun()
+			// A run adds at most 5 bytes to the block.
+			if len(w.block)+5 > w.max {
+				w.writeBlock()
+				if w.bw.err != nil {
+					return i, w.bw.err
+				}
+			}
+			w.run, w.runLen = b, 1
+		}
+		w.blockCRC = crcUpdate(w.blockCRC, b)
+	}
+	return len(data), w.bw.err
+}
+
+// flushRun appends the current run to the block: runs of up to
+// three bytes as they are, longer runs as four bytes and a count.
+func (w *goWriter) flushRun() {
+	if w.runLen < 4 {
+		for i := 0; i < w.runLen; i++ {
+			w.block = append(w.block, w.run)
+		}
+	} else {
+		w.block = append(w.block, w.run, w.run, w.run, w.run, byte(w.runLen-4))
+	}
+	w.runLen = 0
+}
+
+// Close flushes the compressed data and closes the stream.
+// It does not close the underlying io.Writer.
+func (w *goWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	w.flushRun()
+	if len(w.block) > 0 {
+		w.writeBlock()
+	}
+	w.bw.writeBits(48, 0x177245385090) // sqrt(pi)
+	w.bw.writeBits(32, uint64(w.streamCRC))
+	w.bw.flush()
+	return w.bw.err
+}
+
+// writeBlock compresses and writes the current block.
+func (w *goWriter) writeBlock() {
+	crc := ^w.blockCRC
+	w.streamCRC = (w.streamCRC<<1 | w.streamCRC>>31) ^ crc
+	w.blockCRC = 0xffffffff
+	block := w.block
+	w.block = w.block[:0]
+
+	bwt, origPtr := transform(block)
+
+	// The symbols in use, and their MTF indices.
+	var inUse [256]bool
+	for _, b := range block {
+		inUse[b] = true
+	}
+	var order []byte // the bytes in use, at first in order
+	for b := range inUse {
+		if inUse[b] {
+			order = append(order, byte(b))
+		}
+	}
+	eob := len(order) + 1
+	symbols := mtf(bwt, order)
+	symbols = append(symbols, uint16(eob))
+
+	freq := make([]int, eob+1)
+	for _, s := range symbols {
+		freq[s]++
+	}
+	lengths := codeLengths(freq, 17)
+	codes := canonicalCodes(lengths)
+
+	bw := &w.bw
+	bw.writeBits(48, 0x314159265359) // pi
+	bw.writeBits(32, uint64(crc))
+	bw.writeBits(1, 0) // not randomized
+	bw.writeBits(24, uint64(origPtr))
+
+	// The symbols in use, as a map of 16 ranges of 16 bytes each.
+	var ranges uint64
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				ranges |= 1 << uint(15-i)
+			}
+		}
+	}
+	bw.writeBits(16, ranges)
+	for i := 0; i < 16; i++ {
+		if ranges&(1<<uint(15-i)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				bits |= 1 << uint(15-j)
+			}
+		}
+		bw.writeBits(16, bits)
+	}
+
+	// The format requires at least two tables; both are the same.
+	// Each group of 50 symbols selects the first, encoded by MTF
+	// in unary as a single 0 bit.
+	const tables = 2
+	selectors := (len(symbols) + 49) / 50
+	bw.writeBits(3, tables)
+	bw.writeBits(15, uint64(selectors))
+	for i := 0; i < selectors; i++ {
+		bw.writeBits(1, 0)
+	}
+	for t := 0; t < tables; t++ {
+		// The lengths are encoded as differences: 10 adds one,
+		// 11 subtracts one, and 0 moves to the next symbol.
+		cur := lengths[0]
+		bw.writeBits(5, uint64(cur))
+		for _, l := range lengths {
+			for ; cur < l; cur++ {
+				bw.writeBits(2, 2)
+			}
+			for ; cur > l; cur-- {
+				bw.writeBits(2, 3)
+			}
+			bw.writeBits(1, 0)
+		}
+	}
+
+	for _, s := range symbols {
+		bw.writeBits(uint(lengths[s]), uint64(codes[s]))
+	}
+}
+
+// transform returns the Burrows-Wheeler transform of block: the last
+// byte of each rotation of block, in sorted order of the rotations,
+// and the position of block itself among them.
+func transform(block []byte) (bwt []byte, origPtr int) {
+	n := len(block)
+	p := sortRotations(block)
+	bwt = make([]byte, n)
+	for i, start := range p {
+		if start == 0 {
+			origPtr = i
+		}
+		bwt[i] = block[(start+n-1)%n]
+	}
+	return bwt, origPtr
+}
+
+// sortRotations returns the start of each rotation of s, in sorted
+// order of the rotations.  It sorts by the first 1, 2, 4, ... bytes
+// of each rotation in turn, with a counting sort in each round.
+func sortRotations(s []byte) []int {
+	n := len(s)
+	p := make([]int, n)     // rotations, sorted by their first k bytes
+	class := make([]int, n) // equivalence class of each rotation
+	cnt := make([]int, n+256)
+	for _, b := range s {
+		cnt[b]++
+	}
+	for i := 1; i < 256; i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		cnt[s[i]]--
+		p[cnt[s[i]]] = i
+	}
+	classes := 1
+	for i := 1; i < n; i++ {
+		if s[p[i]] != s[p[i-1]] {
+			classes++
+		}
+		class[p[i]] = classes - 1
+	}
+
+	pn := make([]int, n)
+	cn := make([]int, n)
+	for k := 1; k < n && classes < n; k *= 2 {
+		// Sort by the second half (already sorted in p),
+		// then stably by the first.
+		for i, start := range p {
+			pn[i] = (start - k + n) % n
+		}
+		for i := 0; i < classes; i++ {
+			cnt[i] = 0
+		}
+		for _, c := range class {
+			cnt[c]++
+		}
+		for i := 1; i < classes; i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			c := class[pn[i]]
+			cnt[c]--
+			p[cnt[c]] = pn[i]
+		}
+		cn[p[0]] = 0
+		classes = 1
+		for i := 1; i < n; i++ {
+			cur, prev := p[i], p[i-1]
+			if class[cur] != class[prev] || class[(cur+k)%n] != class[(prev+k)%n] {
+				classes++
+			}
+			cn[cur] = classes - 1
+		}
+		class, cn = cn, class
+	}
+	return p
+}
+
+// mtf returns the move-to-front transform of data, in which each
+// byte is replaced by its index in order, which initially holds the
+// bytes in use, and then moved to the front.  The index i > 0 is
+// encoded as the symbol i+1, and each run of zeros as a number in
+// bijective base 2, with the digits RUNA (0) and RUNB (1).
+func mtf(data []byte, order []byte) []uint16 {
+	order = append([]byte(nil), order...)
+	var symbols []uint16
+	zeros := 0
+	flushZeros := func() {
+		for zeros > 0 {
+			zeros--
+			symbols = append(symbols, uint16(zeros&1)) // RUNA or RUNB
+			zeros >>= 1
+		}
+	}
+	for _, b := range data {
+		i := 0
+		for order[i] != b {
+			i++
+		}
+		if i == 0 {
+			zeros++
+			continue
+		}
+		flushZeros()
+		copy(order[1:i+1], order[:i])
+		order[0] = b
+		symbols = append(symbols, uint16(i+1))
+	}
+	flushZeros()
+	return symbols
+}
+
+// codeLengths returns the lengths of the Huffman codes for symbols
+// with the given frequencies, none longer than limit.  If the code
+// would be too long, it flattens the frequencies and tries again.
+func codeLengths(freq []int, limit int) []uint8 {
+	weights := make([]int, len(freq))
+	for i, f := range freq {
+		weights[i] = f + 1 // every symbol needs a code
+	}
+	for {
+		lengths := huffman(weights)
+		longest := uint8(0)
+		for _, l := range lengths {
+			if l > longest {
+				longest = l
+			}
+		}
+		if int(longest) <= limit {
+			return lengths
+		}
+		for i := range weights {
+			weights[i] = weights[i]/2 + 1
+		}
+	}
+}
+
+// huffman returns the lengths of the codes of a Huffman code
+// for symbols with the given weights, of which there are at least 2.
+func huffman(weights []int) []uint8 {
+	type node struct {
+		weight      int
+		left, right int // children, or -1 for a leaf
+	}
+	var nodes []node
+	var queue []int // indices of the roots of trees, by weight
+	for _, w := range weights {
+		queue = append(queue, len(nodes))
+		nodes = append(nodes, node{w, -1, -1})
+	}
+	for len(queue) > 1 {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return nodes[queue[i]].weight < nodes[queue[j]].weight
+		})
+		x, y := queue[0], queue[1]
+		queue = append(queue[2:], len(nodes))
+		nodes = append(nodes, node{nodes[x].weight + nodes[y].weight, x, y})
+	}
+	lengths := make([]uint8, len(weights))
+	var walk func(i int, depth uint8)
+	walk = func(i int, depth uint8) {
+		if nodes[i].left < 0 {
+			lengths[i] = depth
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	walk(queue[0], 0)
+	return lengths
+}
+
+// canonicalCodes returns the codes that a decoder assigns to symbols
+// with the given code lengths: consecutive values, in order of length
+// and then of symbol.
+func canonicalCodes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	code := uint32(0)
+	for l := uint8(1); l <= 32; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// A bitWriter writes bits, most significant first.
+type bitWriter struct {
+	w    io.Writer
+	bits uint64 // pending bits, in the low n bits
+	n    uint
+	buf  []byte
+	err  error
+}
+
+func (bw *bitWriter) writeBits(n uint, v uint64) {
+	for n > 0 {
+		k := n
+		if k > 32 {
+			k = 32
+		}
+		n -= k
+		bw.bits = bw.bits<<k | (v>>n)&(1<<k-1)
+		bw.n += k
+		for bw.n >= 8 {
+			bw.n -= 8
+			bw.buf = append(bw.buf, byte(bw.bits>>bw.n))
+		}
+	}
+	if len(bw.buf) >= 4096 {
+		bw.writeBuf()
+	}
+}
+
+func (bw *bitWriter) writeBuf() {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(bw.buf)
+	}
+	bw.buf = bw.buf[:0]
+}
+
+// flush writes the pending bits, padded with zeros to a byte.
+func (bw *bitWriter) flush() {
+	if bw.n > 0 {
+		bw.writeBits(8-bw.n, 0)
+	}
+	bw.writeBuf()
+}
+
+var crcTable = func() (table [256]uint32) {
+	// The CRC-32 of bzip2 uses the polynomial of IEEE 802.3,
+	// but most significant bit first.
+	const poly = 0x04c11db7
+	for i := range table {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ poly
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return
+}()
+
+func crcUpdate(crc uint32, b byte) uint32 {
+	return crc<<8 ^ crcTable[byte(crc>>24)^b]
+}
@@ -0,0 +1,15 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip
+
+import "io"
+
+// The pure-Go implementations, which the package uses without cgo,
+// for tests with cgo.
+
+func NewGoWriter(out io.Writer, blockSize int) io.WriteCloser {
+	return newGoWriter(out, blockSize)
+}
+
+func NewGoReader(in io.Reader) io.ReadCloser { return newGoReader(in) }
@@ -0,0 +1,50 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip
+
+import (
+	"compress/bzip2"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A goReader decompresses bzip2-compressed data in pure Go,
+// using compress/bzip2.
+type goReader struct {
+	mu     sync.Mutex
+	r      io.Reader
+	closed bool
+}
+
+func newGoReader(in io.Reader) *goReader {
+	return &goReader{r: bzip2.NewReader(in)}
+}
+
+func (r *goReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, ErrClosed
+	}
+	n, err := r.r.Read(p)
+	if err, ok := err.(bzip2.StructuralError); ok {
+		// Report the same errors as libbzip2.
+		if strings.Contains(string(err), "magic") {
+			return n, ErrNotBzip2
+		}
+		return n, ErrCorrupt
+	}
+	return n, err
+}
+
+func (r *goReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	r.closed = true
+	return nil
+}
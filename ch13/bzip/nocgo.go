@@ -0,0 +1,38 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+//go:build !cgo
+
+package bzip
+
+import "io"
+
+// Without cgo, the package uses a compressor in pure Go,
+// and compress/bzip2 to decompress.
+
+// NewWriter returns a writer for bzip2-compressed streams.
+// It is safe to call its methods concurrently.
+func NewWriter(out io.Writer) io.WriteCloser {
+	w, err := NewWriterLevel(out, Options{})
+	if err != nil {
+		return errWriter{err}
+	}
+	return w
+}
+
+// NewWriterLevel is like NewWriter but compresses as opts specifies.
+func NewWriterLevel(out io.Writer, opts Options) (io.WriteCloser, error) {
+	blockSize, _, err := opts.values()
+	if err != nil {
+		return nil, err
+	}
+	return newGoWriter(out, blockSize), nil
+}
+
+// NewReader returns a reader that decompresses bzip2-compressed
+// data from in.  The data may be a concatenation of streams, as
+// written by several writers; the reader returns all their contents.
+// Close releases the resources of the reader; it does not close in.
+func NewReader(in io.Reader) io.ReadCloser {
+	return newGoReader(in)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClosed is returned by the methods of a closed writer or reader.
+var ErrClosed = errors.New("bzip: use of closed stream")
+
+// ErrCorrupt and ErrNotBzip2 are returned by a reader for invalid
+// input; a reader returns io.ErrUnexpectedEOF for truncated input.
+var (
+	ErrCorrupt  = errors.New("bzip: corrupt data")
+	ErrNotBzip2 = errors.New("bzip: not bzip2 data")
+)
+
+// Options controls the compression of NewWriterLevel.
+type Options struct {
+	// BlockSize is the size of the blocks that are compressed,
+	// from 1 to 9, in units of 100,000 bytes.  Larger blocks
+	// compress better but use more memory.  Zero means 9.
+	BlockSize int
+
+	// WorkFactor, from 1 to 250, controls how hard libbzip2 tries
+	// to sort highly repetitive input before it falls back to a
+	// slower algorithm.  Zero means 30.  The pure-Go compressor,
+	// which always uses the same algorithm, ignores it.
+	WorkFactor int
+}
+
+// values returns the block size and work factor of opts,
+// with defaults for zero values.
+func (opts Options) values() (blockSize, workFactor int, err error) {
+	blockSize, workFactor = opts.BlockSize, opts.WorkFactor
+	if blockSize == 0 {
+		blockSize = 9
+	}
+	if workFactor == 0 {
+		workFactor = 30
+	}
+	if blockSize < 1 || blockSize > 9 {
+		return 0, 0, fmt.Errorf("bzip: invalid block size %d", opts.BlockSize)
+	}
+	if workFactor < 1 || workFactor > 250 {
+		return 0, 0, fmt.Errorf("bzip: invalid work factor %d", opts.WorkFactor)
+	}
+	return blockSize, workFactor, nil
+}
+
+// An errWriter is a writer that could not be created.
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+func (w errWriter) Close() error              { return w.err }
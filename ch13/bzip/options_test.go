@@ -0,0 +1,119 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"gopl.io/ch13/bzip"
+)
+
+func TestWriterLevel(t *testing.T) {
+	data := sample(250000)
+	for level := 1; level <= 9; level++ {
+		var buf bytes.Buffer
+		w, err := bzip.NewWriterLevel(&buf, bzip.Options{BlockSize: level, WorkFactor: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String()[:4], "BZh"+string(rune('0'+level)); got != want {
+			t.Errorf("level %d: header %q, want %q", level, got, want)
+		}
+		got, err := decompress(&buf)
+		if err != nil {
+			t.Errorf("level %d: %v", level, err)
+		} else if !bytes.Equal(got, data) {
+			t.Errorf("level %d: decompressed %d different bytes", level, len(got))
+		}
+	}
+
+	for _, opts := range []bzip.Options{
+		{BlockSize: 10},
+		{BlockSize: -1},
+		{WorkFactor: 251},
+	} {
+		if _, err := bzip.NewWriterLevel(io.Discard, opts); err == nil {
+			t.Errorf("NewWriterLevel(%+v) succeeded", opts)
+		}
+	}
+}
+
+// inputs returns inputs that exercise the steps of compression.
+func inputs() map[string][]byte {
+	random := make([]byte, 300000)
+	rand.New(rand.NewSource(1)).Read(random)
+	return map[string][]byte{
+		"empty":  nil,
+		"byte":   []byte("x"),
+		"text":   sample(250000),
+		"random": random, // all 256 bytes, in several blocks
+		"runs": []byte(strings.Repeat("a", 1000) + strings.Repeat("b", 4) +
+			strings.Repeat("c", 255) + strings.Repeat("d", 256) + "e"),
+		"repeats": bytes.Repeat([]byte("hello"), 200000), // periodic blocks
+		"skewed": func() []byte {
+			// Fibonacci frequencies make for long Huffman codes.
+			var b []byte
+			f1, f2 := 1, 1
+			for c := byte('A'); c < 'A'+26; c++ {
+				for i := 0; i < f1 && i < 100000; i++ {
+					b = append(b, c, byte(i))
+				}
+				f1, f2 = f2, f1+f2
+			}
+			return b
+		}(),
+	}
+}
+
+// TestGoImplementations checks that the pure-Go compressor and
+// decompressor, used without cgo, agree with those the package
+// uses, and with the bzip2 command.
+func TestGoImplementations(t *testing.T) {
+	_, err := exec.LookPath("bzip2")
+	haveCommand := err == nil
+	for name, data := range inputs() {
+		var buf bytes.Buffer
+		w := bzip.NewGoWriter(&buf, 1)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		compressed := buf.Bytes()
+
+		got, err := decompress(bytes.NewReader(compressed))
+		if err != nil {
+			t.Errorf("%s: NewReader: %v", name, err)
+		} else if !bytes.Equal(got, data) {
+			t.Errorf("%s: NewReader decompressed %d different bytes", name, len(got))
+		}
+
+		if haveCommand {
+			cmd := exec.Command("bzip2", "-d", "-c")
+			cmd.Stdin = bytes.NewReader(compressed)
+			got, err := cmd.Output()
+			if err != nil {
+				t.Errorf("%s: bzip2 -d: %v", name, err)
+			} else if !bytes.Equal(got, data) {
+				t.Errorf("%s: bzip2 -d decompressed %d different bytes", name, len(got))
+			}
+		}
+
+		r := bzip.NewGoReader(bytes.NewReader(compress(t, data)))
+		got, err = io.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: NewGoReader: %v", name, err)
+		} else if !bytes.Equal(got, data) {
+			t.Errorf("%s: NewGoReader decompressed %d different bytes", name, len(got))
+		}
+	}
+}
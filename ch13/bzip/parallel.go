@@ -0,0 +1,190 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// DefaultBlockSize is the number of input bytes that a parallel
+// writer compresses into each stream by default: the size of the
+// largest bzip2 block.
+const DefaultBlockSize = 900 * 1000
+
+// A parallelWriter cuts its input into blocks and compresses each
+// block into an independent bzip2 stream, in the style of pbzip2.
+// Workers compress the blocks concurrently; a single goroutine
+// writes the streams in order.
+type parallelWriter struct {
+	mu        sync.Mutex // guards buf and closed, and serializes calls
+	blockSize int
+	level     int    // Options.BlockSize of each stream
+	buf       []byte // the current block
+	submitted bool   // a block has been submitted
+	closed    bool
+
+	jobs    chan job
+	results chan chan []byte // results of the jobs, in submission order
+	done    chan struct{}    // closed when all results have been written
+	quit    chan struct{}    // closed after a write error
+
+	errMu sync.Mutex
+	err   error // the first write error
+}
+
+type job struct {
+	data   []byte
+	result chan<- []byte
+}
+
+// NewParallelWriter returns a writer for bzip2-compressed data that
+// compresses blocks of blockSize input bytes concurrently in workers
+// goroutines and writes them to out as a sequence of bzip2 streams,
+// which NewReader and the bzip2 command decompress as one.
+// If blockSize or workers is not positive, it uses DefaultBlockSize
+// or the number of CPUs.  Each stream uses the smallest bzip2 block
+// size that holds blockSize bytes, so that a block size of n * 100,000
+// bytes compresses like bzip2 -n.  It is safe to call its methods
+// concurrently.
+//
+// The goroutines exit after a write error, or when Close is called;
+// the caller must call Close to release them.
+func NewParallelWriter(out io.Writer, blockSize, workers int) io.WriteCloser {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	level := (blockSize + 100*1000 - 1) / (100 * 1000)
+	if level > 9 {
+		level = 9
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	p := &parallelWriter{
+		blockSize: blockSize,
+		level:     level,
+		jobs:      make(chan job),
+		results:   make(chan chan []byte, 2*workers),
+		done:      make(chan struct{}),
+		quit:      make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	go func() {
+		defer close(p.done)
+		for result := range p.results {
+			if _, err := out.Write(<-result); err != nil {
+				p.errMu.Lock()
+				p.err = err
+				p.errMu.Unlock()
+				close(p.quit) // stop the workers and unblock submit
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// worker compresses blocks until the jobs channel is closed
+// or a write fails.
+func (p *parallelWriter) worker() {
+	for {
+		select {
+		case j, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			j.result <- compressBlock(j.data, p.level)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *parallelWriter) error() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
+
+// compressBlock returns data compressed as one bzip2 stream,
+// with bzip2 blocks of the given size, which NewParallelWriter
+// keeps from 1 to 9.
+func compressBlock(data []byte, level int) []byte {
+	var buf bytes.Buffer
+	w, _ := NewWriterLevel(&buf, Options{BlockSize: level})
+	w.Write(data) // writes to a bytes.Buffer do not fail
+	w.Close()
+	return buf.Bytes()
+}
+
+// submit sends the current block to the workers,
+// waiting if too many are already in progress.
+// It reports the write error that stopped the workers, if any.
+func (p *parallelWriter) submit() error {
+	result := make(chan []byte, 1)
+	select {
+	case p.results <- result:
+	case <-p.quit:
+		return p.error()
+	}
+	select {
+	case p.jobs <- job{p.buf, result}:
+	case <-p.quit:
+		return p.error()
+	}
+	p.buf = nil
+	p.submitted = true
+	return nil
+}
+
+func (p *parallelWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, ErrClosed
+	}
+	var total int
+	for len(data) > 0 {
+		if err := p.error(); err != nil {
+			return total, err
+		}
+		if p.buf == nil {
+			p.buf = make([]byte, 0, p.blockSize)
+		}
+		n := copy(p.buf[len(p.buf):p.blockSize], data)
+		p.buf = p.buf[:len(p.buf)+n]
+		data = data[n:]
+		total += n
+		if len(p.buf) == p.blockSize {
+			if err := p.submit(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// Close compresses the last block, waits for all the streams to be
+// written, and reports the first write error, if any.
+// It does not close the underlying io.Writer.
+func (p *parallelWriter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+	if len(p.buf) > 0 || !p.submitted {
+		p.submit() // an empty input becomes one empty stream
+	}
+	close(p.jobs)
+	close(p.results)
+	<-p.done
+	return p.error()
+}
@@ -0,0 +1,176 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopl.io/ch13/bzip"
+)
+
+func TestParallelWriter(t *testing.T) {
+	data := sample(1000000)
+	for _, test := range []struct {
+		n, blockSize, workers int
+		level                 int // bzip2 block size of each stream
+		streams               int
+	}{
+		{0, 100000, 4, 1, 1},
+		{1, 100000, 4, 1, 1},
+		{100000, 100000, 4, 1, 1},
+		{1000000, 100000, 4, 1, 10},
+		{1000000, 300000, 1, 3, 4},
+		{1000000, 250000, 2, 3, 4},
+		{1000000, 0, 0, 9, 2},
+		{1000000, 2000000, 2, 9, 1},
+	} {
+		var compressed bytes.Buffer
+		w := bzip.NewParallelWriter(&compressed, test.blockSize, test.workers)
+		// Write in pieces that do not align with blocks.
+		for rest := data[:test.n]; len(rest) > 0; {
+			n := 7777
+			if n > len(rest) {
+				n = len(rest)
+			}
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Each stream begins with the magic "BZh" and its block size.
+		magic := fmt.Sprintf("BZh%d", test.level)
+		if got := bytes.Count(compressed.Bytes(), []byte(magic)); got < test.streams {
+			t.Errorf("%+v: wrote %d streams, want %d", test, got, test.streams)
+		}
+		got, err := decompress(&compressed)
+		if err != nil {
+			t.Errorf("%+v: %v", test, err)
+		} else if !bytes.Equal(got, data[:test.n]) {
+			t.Errorf("%+v: decompressed %d different bytes", test, len(got))
+		}
+	}
+}
+
+// TestConcurrentWrites checks that each Write of the writers
+// returned by NewWriter and NewParallelWriter is atomic.
+func TestConcurrentWrites(t *testing.T) {
+	for _, newWriter := range []func(io.Writer) io.WriteCloser{
+		bzip.NewWriter,
+		func(w io.Writer) io.WriteCloser { return bzip.NewParallelWriter(w, 1000, 4) },
+	} {
+		var compressed bytes.Buffer
+		w := newWriter(&compressed)
+		var want []string
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			for j := 0; j < 100; j++ {
+				want = append(want, fmt.Sprintf("goroutine %d line %d", i, j))
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					fmt.Fprintf(w, "goroutine %d line %d\n", i, j)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := decompress(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+		sort.Strings(lines)
+		sort.Strings(want)
+		if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+			t.Errorf("concurrent writes were interleaved")
+		}
+	}
+}
+
+func TestClosed(t *testing.T) {
+	for _, w := range []io.WriteCloser{
+		bzip.NewWriter(io.Discard),
+		bzip.NewParallelWriter(io.Discard, 0, 0),
+	} {
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("hello")); err != bzip.ErrClosed {
+			t.Errorf("Write after Close returned %v, want ErrClosed", err)
+		}
+		if err := w.Close(); err != bzip.ErrClosed {
+			t.Errorf("second Close returned %v, want ErrClosed", err)
+		}
+	}
+
+	r := bzip.NewReader(bytes.NewReader(compress(t, nil)))
+	r.Close()
+	if _, err := r.Read(make([]byte, 1)); err != bzip.ErrClosed {
+		t.Errorf("Read after Close returned %v, want ErrClosed", err)
+	}
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestParallelWriterError(t *testing.T) {
+	w := bzip.NewParallelWriter(&failingWriter{n: 2}, 1000, 2)
+	data := sample(100000)
+	var err error
+	for i := 0; i < len(data) && err == nil; i += 1000 {
+		_, err = w.Write(data[i : i+1000])
+	}
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("Write returned %v, want disk full", err)
+	}
+	if cerr := w.Close(); cerr == nil || cerr.Error() != "disk full" {
+		t.Errorf("Close returned %v, want disk full", cerr)
+	}
+}
+
+// TestParallelWriterErrorExit checks that the goroutines of a
+// parallel writer exit after a write error, even without Close.
+func TestParallelWriterErrorExit(t *testing.T) {
+	before := runtime.NumGoroutine()
+	w := bzip.NewParallelWriter(&failingWriter{n: 1}, 1000, 4)
+	data := sample(100000)
+	var err error
+	for i := 0; i < len(data) && err == nil; i += 1000 {
+		_, err = w.Write(data[i : i+1000])
+	}
+	if err == nil {
+		t.Fatal("Write did not fail")
+	}
+	for start := time.Now(); runtime.NumGoroutine() > before; {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("%d goroutines remain after a write error, want %d",
+				runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
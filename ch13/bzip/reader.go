@@ -0,0 +1,131 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+//go:build cgo
+
+package bzip
+
+/*
+#cgo CFLAGS: -I/usr/include
+#cgo LDFLAGS: -L/usr/lib -lbz2
+#include <bzlib.h>
+bz_stream* bz2alloc();
+int bz2decompress(bz_stream *s,
+                  char *in, unsigned *inlen, char *out, unsigned *outlen);
+void bz2free(bz_stream* s);
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+type reader struct {
+	r      io.Reader // underlying input stream
+	stream *C.bz_stream
+	inbuf  [64 * 1024]byte
+	in     []byte // unconsumed input, in inbuf
+	eof    bool   // r has reported io.EOF
+	fresh  bool   // stream has consumed no input since it was initialized
+	ended  bool   // at least one stream has ended
+	err    error  // sticky error
+}
+
+// NewReader returns a reader that decompresses bzip2-compressed
+// data from in.  The data may be a concatenation of streams, as
+// written by several writers; the reader returns all their contents.
+// Close releases the resources of the reader; it does not close in.
+func NewReader(in io.Reader) io.ReadCloser {
+	r := &reader{r: in, stream: C.bz2alloc()}
+	r.init()
+	return r
+}
+
+// init prepares r.stream to decompress a new stream.
+func (r *reader) init() {
+	const verbosity = 0
+	const small = 0 // use the faster algorithm, not the one that saves memory
+	if code := C.BZ2_bzDecompressInit(r.stream, verbosity, small); code != C.BZ_OK {
+		r.err = bzError(code)
+	}
+	r.fresh = true
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.stream == nil {
+		return 0, ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, r.err
+	}
+	for r.err == nil {
+		if len(r.in) == 0 && !r.eof {
+			n, err := r.r.Read(r.inbuf[:])
+			r.in = r.inbuf[:n]
+			if err == io.EOF {
+				r.eof = true
+			} else if err != nil {
+				r.err = err
+				break
+			}
+		}
+		if len(r.in) == 0 && r.eof {
+			if r.fresh && r.ended {
+				r.err = io.EOF // end of the last stream
+			} else {
+				r.err = io.ErrUnexpectedEOF
+			}
+			break
+		}
+
+		inlen, outlen := C.uint(len(r.in)), C.uint(len(p))
+		code := C.bz2decompress(r.stream,
+			(*C.char)(unsafe.Pointer(&r.in[0])), &inlen,
+			(*C.char)(unsafe.Pointer(&p[0])), &outlen)
+		r.in = r.in[inlen:]
+		if inlen > 0 {
+			r.fresh = false
+		}
+		switch code {
+		case C.BZ_OK:
+		case C.BZ_STREAM_END:
+			// Another stream may follow.
+			C.BZ2_bzDecompressEnd(r.stream)
+			r.init()
+			r.ended = true
+		default:
+			r.err = bzError(code)
+		}
+		if outlen > 0 {
+			return int(outlen), nil
+		}
+	}
+	return 0, r.err
+}
+
+// Close releases the resources of the reader.
+// It does not close the underlying io.Reader.
+func (r *reader) Close() error {
+	if r.stream == nil {
+		return ErrClosed
+	}
+	C.BZ2_bzDecompressEnd(r.stream)
+	C.bz2free(r.stream)
+	r.stream = nil
+	return nil
+}
+
+// bzError returns an error for a libbzip2 error code.
+func bzError(code C.int) error {
+	switch code {
+	case C.BZ_DATA_ERROR:
+		return ErrCorrupt
+	case C.BZ_DATA_ERROR_MAGIC:
+		return ErrNotBzip2
+	case C.BZ_MEM_ERROR:
+		return fmt.Errorf("bzip: out of memory")
+	}
+	return fmt.Errorf("bzip: libbzip2 error %d", code)
+}
@@ -0,0 +1,136 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package bzip_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"gopl.io/ch13/bzip"
+)
+
+// compress returns data compressed by bzip.NewWriter.
+func compress(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := bzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decompress returns the contents of r, decompressed by bzip.NewReader.
+func decompress(r io.Reader) ([]byte, error) {
+	zr := bzip.NewReader(r)
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// sample returns n bytes of compressible, but not trivially
+// compressible, text.
+func sample(n int) []byte {
+	words := strings.Fields("the quick brown fox jumps over the lazy dog")
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(words[rng.Intn(len(words))])
+		buf.WriteByte(" \n"[rng.Intn(2)])
+	}
+	return buf.Bytes()[:n]
+}
+
+func TestReader(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 1000000} {
+		data := sample(n)
+		compressed := compress(t, data)
+		for _, r := range []io.Reader{
+			bytes.NewReader(compressed),
+			iotest.OneByteReader(bytes.NewReader(compressed)),
+			iotest.DataErrReader(bytes.NewReader(compressed)),
+		} {
+			got, err := decompress(r)
+			if err != nil {
+				t.Errorf("%d bytes: %v", n, err)
+			} else if !bytes.Equal(got, data) {
+				t.Errorf("%d bytes: decompressed %d different bytes", n, len(got))
+			}
+		}
+	}
+}
+
+func TestReaderConcatenated(t *testing.T) {
+	a, b := sample(5000), []byte("hello, world\n")
+	compressed := append(compress(t, a), compress(t, b)...)
+	got, err := decompress(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(a, b...); !bytes.Equal(got, want) {
+		t.Errorf("decompressed %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	compressed := compress(t, sample(100000))
+	corrupt := append([]byte(nil), compressed...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	for _, test := range []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"empty", nil, "unexpected EOF"},
+		{"truncated", compressed[:len(compressed)/2], "unexpected EOF"},
+		{"corrupt", corrupt, "corrupt data"},
+		{"not bzip2", []byte("hello, world"), "not bzip2 data"},
+		{"trailing garbage", append(compress(t, nil), "garbage"...), "not bzip2 data"},
+	} {
+		_, err := decompress(bytes.NewReader(test.in))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+// TestCommand checks that the bzip2 command and this package
+// can read each other's output.
+func TestCommand(t *testing.T) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("no bzip2 command")
+	}
+	data := sample(300000)
+
+	cmd := exec.Command("bzip2", "-c")
+	cmd.Stdin = bytes.NewReader(data)
+	compressed, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decompress(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("NewReader decompressed bzip2 output incorrectly")
+	}
+
+	cmd = exec.Command("bzip2", "-d", "-c")
+	cmd.Stdin = bytes.NewReader(compress(t, data))
+	got, err = cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("bzip2 decompressed NewWriter output incorrectly")
+	}
+}
@@ -3,27 +3,368 @@
 
 // See page 365.
 
-//!+
-
-// Bzipper reads input, bzip2-compresses it, and writes it out.
+// Bzipper compresses or decompresses files in the bzip2 format,
+// in the manner of the bzip2 command.
+//
+// Usage:
+//
+//	bzipper [-d | -t] [-k] [-c] [-f] [-v] [-1 ... -9] [-p] [-j n] [file ...]
+//
+// Without files, bzipper reads the standard input and writes the
+// standard output.  Otherwise it replaces each file by a compressed
+// file with the suffix .bz2, or, with -d, each compressed file by a
+// decompressed file without the suffix, processing several files at
+// once.  The flags are:
+//
+//	-d    decompress
+//	-t    test the integrity of compressed files; write nothing
+//	-k    keep the input files
+//	-c    write to the standard output, and keep the input files
+//	-f    overwrite existing output files
+//	-v    report progress and compression ratios on the standard error
+//	-1 ... -9
+//	      compress in blocks of 100,000 to 900,000 bytes (default -9)
+//	-p    compress the blocks of each file in parallel, as pbzip2 does
+//	-j n  process at most n files at once (default: the number of CPUs)
+//
+// The exit status is 0 on success, 2 if some compressed input was
+// corrupt, or 1 for any other error, such as an I/O error.
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io"
-	"log"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"gopl.io/ch13/bzip"
 )
 
+// options holds the settings of the command line.
+type options struct {
+	decompress bool
+	test       bool
+	keep       bool
+	stdout     bool
+	force      bool
+	verbose    bool
+	level      int
+	parallel   bool
+
+	stderr   io.Writer
+	stderrMu sync.Mutex // serializes messages
+}
+
+// A levelFlag is one of the flags -1 to -9, which set the block size.
+type levelFlag struct {
+	level *int
+	n     int
+}
+
+func (f levelFlag) String() string   { return "" }
+func (f levelFlag) IsBoolFlag() bool { return true }
+func (f levelFlag) Set(s string) error {
+	if s == "true" {
+		*f.level = f.n
+	}
+	return nil
+}
+
 func main() {
-	w := bzip.NewWriter(os.Stdout)
-	if _, err := io.Copy(w, os.Stdin); err != nil {
-		log.Fatalf("bzipper: %v\n", err)
+	opts := &options{level: 9, stderr: os.Stderr}
+	flag.BoolVar(&opts.decompress, "d", false, "decompress")
+	flag.BoolVar(&opts.test, "t", false, "test the integrity of compressed files")
+	flag.BoolVar(&opts.keep, "k", false, "keep the input files")
+	flag.BoolVar(&opts.stdout, "c", false, "write to the standard output")
+	flag.BoolVar(&opts.force, "f", false, "overwrite existing output files")
+	flag.BoolVar(&opts.verbose, "v", false, "report progress on the standard error")
+	for n := 1; n <= 9; n++ {
+		flag.Var(levelFlag{&opts.level, n}, fmt.Sprint(n),
+			fmt.Sprintf("compress in blocks of %d00,000 bytes", n))
+	}
+	flag.BoolVar(&opts.parallel, "p", false, "compress the blocks of each file in parallel")
+	jobs := flag.Int("j", runtime.NumCPU(), "process at most `n` files at once")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bzipper [flags] [file ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if opts.test {
+		opts.decompress = true
+	}
+
+	if flag.NArg() == 0 {
+		os.Exit(opts.exitStatus(opts.processStdin()))
+	}
+	if opts.stdout || *jobs < 1 {
+		*jobs = 1 // keep the output in order
+	}
+
+	// Process the files in a pool of goroutines.
+	names := make(chan string)
+	errs := make(chan error)
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				errs <- opts.processFile(name)
+			}
+		}()
+	}
+	go func() {
+		for _, name := range flag.Args() {
+			names <- name
+		}
+		close(names)
+		wg.Wait()
+		close(errs)
+	}()
+	status := 0
+	for err := range errs {
+		if s := opts.exitStatus(err); s > status {
+			status = s
+		}
+	}
+	os.Exit(status)
+}
+
+// exitStatus reports err, if non-nil, on opts.stderr, and returns
+// the exit status for it: 2 for corrupt input, or 1 for other errors.
+func (opts *options) exitStatus(err error) int {
+	if err == nil {
+		return 0
 	}
-	if err := w.Close(); err != nil {
-		log.Fatalf("bzipper: close: %v\n", err)
+	opts.printf("bzipper: %v\n", err)
+	if fe, ok := err.(*fileError); ok && isCorrupt(fe.err) {
+		return 2
 	}
+	return 1
+}
+
+// A fileError is an error in processing a file.
+type fileError struct {
+	name string
+	err  error
+}
+
+func (e *fileError) Error() string { return e.name + ": " + e.err.Error() }
+
+// isCorrupt reports whether err is an error of a reader for
+// invalid compressed input.
+func isCorrupt(err error) bool {
+	return err == bzip.ErrCorrupt || err == bzip.ErrNotBzip2 || err == io.ErrUnexpectedEOF
 }
 
-//!-
+func (opts *options) processStdin() error {
+	if !opts.decompress && !opts.force && isTerminal(os.Stdout) {
+		return fmt.Errorf("compressed data not written to a terminal (use -f to force)")
+	}
+	var out io.Writer = os.Stdout
+	if opts.test {
+		out = io.Discard
+	}
+	if err := opts.copy(out, os.Stdin, "(stdin)", -1); err != nil {
+		return &fileError{"(stdin)", err}
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a character device,
+// such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// outputName returns the name of the output file for the input
+// file name, and whether name has a suffix that suits the mode.
+func (opts *options) outputName(name string) (string, bool) {
+	if !opts.decompress {
+		return name + ".bz2", !strings.HasSuffix(name, ".bz2")
+	}
+	for _, s := range []struct{ old, new string }{
+		{".bz2", ""}, {".bz", ""}, {".tbz2", ".tar"}, {".tbz", ".tar"},
+	} {
+		if strings.HasSuffix(name, s.old) && len(name) > len(s.old) {
+			return strings.TrimSuffix(name, s.old) + s.new, true
+		}
+	}
+	return name + ".out", false
+}
+
+// processFile compresses, decompresses or tests the named file.
+func (opts *options) processFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err // includes the name
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return &fileError{name, fmt.Errorf("not a regular file")}
+	}
+
+	if opts.test || opts.stdout {
+		out := io.Writer(os.Stdout)
+		if opts.test {
+			out = io.Discard
+		}
+		if err := opts.copy(out, in, name, info.Size()); err != nil {
+			return &fileError{name, err}
+		}
+		if opts.test && opts.verbose {
+			opts.printf("%s: ok\n", name)
+		}
+		return nil
+	}
+
+	outName, ok := opts.outputName(name)
+	if !ok && !opts.decompress {
+		return &fileError{name, fmt.Errorf("already has .bz2 suffix")}
+	}
+	if !ok {
+		opts.printf("bzipper: %s: unknown suffix; writing %s\n", name, outName)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if opts.force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	out, err := os.OpenFile(outName, flags, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = opts.copy(out, in, name, info.Size())
+	if cerr := out.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(outName) // don't leave partial output
+		return &fileError{name, err}
+	}
+	os.Chtimes(outName, info.ModTime(), info.ModTime())
+	if !opts.keep {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy compresses or decompresses the input in, of the given size
+// (or -1 if unknown), to out.  A decompression error from in is
+// returned as is, so that isCorrupt can recognize it.
+func (opts *options) copy(out io.Writer, in io.Reader, name string, size int64) (err error) {
+	cin := &counter{r: in}
+	cout := &counter{w: out}
+	if opts.verbose {
+		done := make(chan struct{})
+		defer close(done)
+		go opts.progress(name, cin, size, done)
+	}
+
+	if opts.decompress {
+		zr := bzip.NewReader(cin)
+		_, err = io.Copy(cout, zr)
+		zr.Close()
+	} else {
+		var zw io.WriteCloser
+		if opts.parallel {
+			// A stream of n * 100,000 bytes is compressed like bzip2 -n.
+			zw = bzip.NewParallelWriter(cout, opts.level*100*1000, 0)
+		} else {
+			zw, err = bzip.NewWriterLevel(cout, bzip.Options{BlockSize: opts.level})
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(zw, cin)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil && opts.verbose && !opts.test {
+		opts.printf("%s: %s\n", name, ratio(cin.count(), cout.count(), opts.decompress))
+	}
+	return err
+}
+
+// ratio describes the compression of n uncompressed bytes
+// into z compressed bytes, in the style of bzip2 -v.
+func ratio(nin, nout int64, decompress bool) string {
+	n, z := nin, nout
+	if decompress {
+		n, z = nout, nin
+	}
+	if n == 0 || z == 0 {
+		return fmt.Sprintf("no data compressed, %d in, %d out.", nin, nout)
+	}
+	return fmt.Sprintf("%.3f:1, %.3f bits/byte, %.2f%% saved, %d in, %d out.",
+		float64(n)/float64(z), 8*float64(z)/float64(n),
+		100*(1-float64(z)/float64(n)), nin, nout)
+}
+
+// progress reports the number of bytes that have been read from in
+// every second, until done is closed.
+func (opts *options) progress(name string, in *counter, size int64, done <-chan struct{}) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+			if size > 0 {
+				opts.printf("%s: %.0f%% of %d bytes\n", name, 100*float64(in.count())/float64(size), size)
+			} else {
+				opts.printf("%s: %d bytes\n", name, in.count())
+			}
+		}
+	}
+}
+
+func (opts *options) printf(format string, args ...interface{}) {
+	opts.stderrMu.Lock()
+	defer opts.stderrMu.Unlock()
+	fmt.Fprintf(opts.stderr, format, args...)
+}
+
+// A counter counts the bytes that are read from r or written to w.
+type counter struct {
+	r  io.Reader
+	w  io.Writer
+	mu sync.Mutex
+	n  int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(n)
+	return n, err
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.add(n)
+	return n, err
+}
+
+func (c *counter) add(n int) {
+	c.mu.Lock()
+	c.n += int64(n)
+	c.mu.Unlock()
+}
+
+func (c *counter) count() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
@@ -0,0 +1,132 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputName(t *testing.T) {
+	for _, test := range []struct {
+		decompress bool
+		name, want string
+		ok         bool
+	}{
+		{false, "a.txt", "a.txt.bz2", true},
+		{false, "a.bz2", "a.bz2.bz2", false},
+		{true, "a.txt.bz2", "a.txt", true},
+		{true, "a.tbz2", "a.tar", true},
+		{true, "a.tbz", "a.tar", true},
+		{true, ".bz2", ".bz2.out", false},
+		{true, "a.txt", "a.txt.out", false},
+	} {
+		opts := &options{decompress: test.decompress}
+		if got, ok := opts.outputName(test.name); got != test.want || ok != test.ok {
+			t.Errorf("outputName(%q), decompress=%t = %q, %t, want %q, %t",
+				test.name, test.decompress, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestProcessFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bzipper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "a.txt")
+	data := []byte(strings.Repeat("hello, world\n", 10000))
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(name)
+		return err == nil
+	}
+	var stderr bytes.Buffer
+
+	// Compress, keeping the input.
+	opts := &options{level: 1, keep: true, stderr: &stderr}
+	if err := opts.processFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(name) || !exists(name+".bz2") {
+		t.Fatalf("after bzipper -k, a.txt exists = %t, a.txt.bz2 exists = %t",
+			exists(name), exists(name+".bz2"))
+	}
+
+	// The output exists, so a second attempt fails, unless forced.
+	if err := opts.processFile(name); err == nil || opts.exitStatus(err) != 1 {
+		t.Errorf("compressing again: got %v, want I/O error", err)
+	}
+	opts.force, opts.keep = true, false
+	if err := opts.processFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if exists(name) {
+		t.Errorf("after bzipper, a.txt exists")
+	}
+
+	// Test, then decompress.
+	opts = &options{test: true, decompress: true, stderr: &stderr}
+	if err := opts.processFile(name + ".bz2"); err != nil {
+		t.Errorf("testing: %v", err)
+	}
+	opts = &options{decompress: true, stderr: &stderr}
+	if err := opts.processFile(name + ".bz2"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("bzipper -d yielded %d different bytes", len(got))
+	}
+	if exists(name + ".bz2") {
+		t.Errorf("after bzipper -d, a.txt.bz2 exists")
+	}
+
+	// Corrupt input is reported with status 2, and leaves no output.
+	bad := filepath.Join(dir, "bad.bz2")
+	if err := ioutil.WriteFile(bad, []byte("BZh9 not really"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = opts.processFile(bad)
+	stderr.Reset()
+	if err == nil || opts.exitStatus(err) != 2 {
+		t.Errorf("decompressing corrupt input: got %v, want status 2", err)
+	}
+	if want := "bzipper: " + bad + ": "; !strings.HasPrefix(stderr.String(), want) {
+		t.Errorf("exitStatus wrote %q, want a message beginning %q", stderr.String(), want)
+	}
+	if exists(filepath.Join(dir, "bad")) {
+		t.Errorf("corrupt input left partial output")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	data := []byte(strings.Repeat("hello, world\n", 20000)) // 260,000 bytes
+	var stderr, compressed, got bytes.Buffer
+	opts := &options{level: 1, parallel: true, stderr: &stderr}
+	if err := opts.copy(&compressed, bytes.NewReader(data), "a.txt", int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	// Level 1 cuts the input into blocks of 100,000 bytes.
+	if n := bytes.Count(compressed.Bytes(), []byte("BZh1")); n != 3 {
+		t.Errorf("bzipper -1 -p wrote %d streams of level 1, want 3", n)
+	}
+	opts = &options{decompress: true, stderr: &stderr}
+	if err := opts.copy(&got, &compressed, "a.txt.bz2", -1); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("bzipper -d yielded %d different bytes", got.Len())
+	}
+}
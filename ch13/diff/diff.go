@@ -0,0 +1,399 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Package diff reports the structural differences between two values.
+//
+// Diff walks two values in parallel, in the manner of
+// gopl.io/ch12/display, and reports each path at which they differ,
+// using display's path syntax, such as (*x).Actor["Grace"][2].
+// Slices are aligned by a longest common subsequence of deeply equal
+// elements (see gopl.io/ch13/equal), so that an insertion is reported
+// as one added element, not as a change to every element after it.
+// Slices too long to align, with more than about a million pairs of
+// elements, are compared element by element.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"gopl.io/ch12/display"
+	"gopl.io/ch13/equal"
+)
+
+// An Op describes how a path differs.
+type Op string
+
+const (
+	Changed Op = "changed" // the path has different values
+	Added   Op = "added"   // the path exists only in the new value
+	Removed Op = "removed" // the path exists only in the old value
+)
+
+// A Change describes one difference between two values.
+type Change struct {
+	Op   Op     `json:"op"`
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"` // formatted old value, unless Added
+	New  string `json:"new,omitempty"` // formatted new value, unless Removed
+}
+
+// Diff returns the differences between the old value x and the new
+// value y, whose common name is name.  It returns nil if they are
+// deeply equal.
+//
+// Paths to removed or changed slice elements use their index in x;
+// paths to added elements use their index in y.
+func Diff(name string, x, y interface{}) []Change {
+	d := &differ{seen: make(map[visit]bool)}
+	d.diff(name, reflect.ValueOf(x), reflect.ValueOf(y))
+	return d.changes
+}
+
+// WriteText writes changes to w in the style of a unified diff:
+// a "-" line with the old value and a "+" line with the new value.
+//
+//	-(*x).Title = "Dr. No"
+//	+(*x).Title = "Dr. Strangelove"
+func WriteText(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		if c.Op != Added {
+			if _, err := fmt.Fprintf(w, "-%s = %s\n", c.Path, c.Old); err != nil {
+				return err
+			}
+		}
+		if c.Op != Removed {
+			if _, err := fmt.Fprintf(w, "+%s = %s\n", c.Path, c.New); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes changes to w as an indented JSON array of objects
+// with fields op, path, old and new.
+func WriteJSON(w io.Writer, changes []Change) error {
+	if changes == nil {
+		changes = []Change{}
+	}
+	data, err := json.MarshalIndent(changes, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// A visit is a pair of pointers already being compared.
+// As in equal, it breaks cycles.
+type visit struct {
+	x, y unsafe.Pointer
+	t    reflect.Type
+}
+
+type differ struct {
+	seen    map[visit]bool
+	changes []Change
+}
+
+func (d *differ) changed(path string, x, y reflect.Value) {
+	d.changes = append(d.changes,
+		Change{Op: Changed, Path: path, Old: format(x), New: format(y)})
+}
+
+func (d *differ) diff(path string, x, y reflect.Value) {
+	if !x.IsValid() || !y.IsValid() {
+		if x.IsValid() != y.IsValid() {
+			d.changed(path, x, y)
+		}
+		return
+	}
+	if x.Type() != y.Type() {
+		d.changed(path, x, y)
+		return
+	}
+
+	switch x.Kind() {
+	case reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.changed(path, x, y)
+			}
+			return
+		}
+		v := visit{unsafe.Pointer(x.Pointer()), unsafe.Pointer(y.Pointer()), x.Type()}
+		if v.x == v.y || d.seen[v] {
+			return // identical, or already being compared
+		}
+		d.seen[v] = true
+		d.diff("(*"+path+")", x.Elem(), y.Elem())
+
+	case reflect.Interface:
+		d.diff(path, x.Elem(), y.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			d.diff(path+"."+x.Type().Field(i).Name, x.Field(i), y.Field(i))
+		}
+
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			d.diff(fmt.Sprintf("%s[%d]", path, i), x.Index(i), y.Index(i))
+		}
+
+	case reflect.Slice:
+		if x.Len() > 0 && y.Len() > 0 {
+			v := visit{unsafe.Pointer(x.Pointer()), unsafe.Pointer(y.Pointer()), x.Type()}
+			if v.x == v.y && x.Len() == y.Len() || d.seen[v] {
+				return
+			}
+			d.seen[v] = true
+		}
+		d.slice(path, x, y)
+
+	case reflect.Map:
+		if x.Len() > 0 && y.Len() > 0 {
+			v := visit{unsafe.Pointer(x.Pointer()), unsafe.Pointer(y.Pointer()), x.Type()}
+			if v.x == v.y || d.seen[v] {
+				return
+			}
+			d.seen[v] = true
+		}
+		d.maps(path, x, y)
+
+	default: // basic types, channels, funcs
+		if !equal.Values(x, y) {
+			d.changed(path, x, y)
+		}
+	}
+}
+
+// slice reports the differences between slices x and y, aligning
+// them by a longest common subsequence of equal elements.  Between
+// matched elements, removed and added elements are paired up and
+// compared element by element; any excess is reported as removed
+// or added.  Slices too long to align are compared element by element.
+func (d *differ) slice(path string, x, y reflect.Value) {
+	n, m := x.Len(), y.Len()
+
+	var removed, added []int // unmatched indices since the last match
+	flush := func() {
+		k := 0
+		for ; k < len(removed) && k < len(added); k++ {
+			i, j := removed[k], added[k]
+			d.diff(fmt.Sprintf("%s[%d]", path, i), x.Index(i), y.Index(j))
+		}
+		for _, i := range removed[k:] {
+			d.changes = append(d.changes, Change{Op: Removed,
+				Path: fmt.Sprintf("%s[%d]", path, i), Old: format(x.Index(i))})
+		}
+		for _, j := range added[k:] {
+			d.changes = append(d.changes, Change{Op: Added,
+				Path: fmt.Sprintf("%s[%d]", path, j), New: format(y.Index(j))})
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	if (n+1)*(m+1) > maxTable {
+		for i := 0; i < n; i++ {
+			removed = append(removed, i)
+		}
+		for j := 0; j < m; j++ {
+			added = append(added, j)
+		}
+		flush()
+		return
+	}
+
+	// Compare hashes first, so that most unequal pairs
+	// need no deep comparison.
+	hx, hy := hashes(x), hashes(y)
+	eq := func(i, j int) bool {
+		return hx[i] == hy[j] && equal.Values(x.Index(i), y.Index(j))
+	}
+
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if eq(i, j) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case lcs[i][j] == lcs[i+1][j+1]+1 && eq(i, j):
+			flush()
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		removed = append(removed, i)
+	}
+	for ; j < m; j++ {
+		added = append(added, j)
+	}
+	flush()
+}
+
+// maxTable bounds the number of cells in the LCS table of slice.
+const maxTable = 1 << 20
+
+// hashes returns the hashes of the elements of the slice v.
+func hashes(v reflect.Value) []uint64 {
+	h := make([]uint64, v.Len())
+	for i := range h {
+		h[i] = equal.HashValue(v.Index(i))
+	}
+	return h
+}
+
+// maps reports the differences between maps x and y, in key order.
+func (d *differ) maps(path string, x, y reflect.Value) {
+	var keys []reflect.Value
+	keys = append(keys, x.MapKeys()...)
+	for _, k := range y.MapKeys() {
+		if !x.MapIndex(k).IsValid() {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return display.Less(keys[i], keys[j]) })
+	for _, k := range keys {
+		kpath := fmt.Sprintf("%s[%s]", path, display.FormatAtom(k))
+		xv, yv := x.MapIndex(k), y.MapIndex(k)
+		switch {
+		case !yv.IsValid():
+			d.changes = append(d.changes,
+				Change{Op: Removed, Path: kpath, Old: format(xv)})
+		case !xv.IsValid():
+			d.changes = append(d.changes,
+				Change{Op: Added, Path: kpath, New: format(yv)})
+		default:
+			d.diff(kpath, xv, yv)
+		}
+	}
+}
+
+// maxDepth bounds the nesting of arrays, slices, structs and maps
+// that format displays.
+const maxDepth = 3
+
+// A pointerVisit is a pointer that format is following.
+type pointerVisit struct {
+	ptr unsafe.Pointer
+	t   reflect.Type
+}
+
+// format formats v in a compact Go-like syntax, for the Old and New
+// fields of a Change.
+func format(v reflect.Value) string {
+	var b strings.Builder
+	formatValue(&b, v, 0, make(map[pointerVisit]bool))
+	return b.String()
+}
+
+// formatValue writes v to b.  Active holds the pointers that lead
+// to v; a pointer that refers back to one of them, which depth alone
+// would not catch in a cycle of pointers and interfaces, is shown
+// as &....
+func formatValue(b *strings.Builder, v reflect.Value, depth int, active map[pointerVisit]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteByte('&')
+		pv := pointerVisit{unsafe.Pointer(v.Pointer()), v.Type()}
+		if active[pv] {
+			b.WriteString("...")
+			return
+		}
+		active[pv] = true
+		formatValue(b, v.Elem(), depth, active)
+		delete(active, pv)
+		return
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		formatValue(b, v.Elem(), depth, active)
+		return
+	case reflect.Array, reflect.Slice, reflect.Struct, reflect.Map:
+		if v.Kind() == reflect.Slice && v.IsNil() ||
+			v.Kind() == reflect.Map && v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteString(display.FormatAtom(v))
+		return
+	default:
+		b.WriteString(display.FormatAtom(v))
+		return
+	}
+
+	b.WriteString(v.Type().String())
+	if depth >= maxDepth {
+		b.WriteString("{...}")
+		return
+	}
+	b.WriteByte('{')
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			formatValue(b, v.Index(i), depth+1, active)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(v.Type().Field(i).Name)
+			b.WriteString(": ")
+			formatValue(b, v.Field(i), depth+1, active)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return display.Less(keys[i], keys[j]) })
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(display.FormatAtom(k))
+			b.WriteString(": ")
+			formatValue(b, v.MapIndex(k), depth+1, active)
+		}
+	}
+	b.WriteByte('}')
+}
@@ -0,0 +1,154 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package diff
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+type Movie struct {
+	Title  string
+	Year   int
+	Actor  map[string][]string
+	Oscars []string
+	Sequel *Movie
+}
+
+func Example() {
+	x := &Movie{
+		Title: "Dr. Strangelove",
+		Year:  1964,
+		Actor: map[string][]string{
+			"Grace":    {"Tracy Reed", "Miss Scott", "Foreign Affairs"},
+			"Mandrake": {"Peter Sellers"},
+		},
+		Oscars: []string{"Best Actor", "Best Director", "Best Picture"},
+	}
+	y := &Movie{
+		Title: "Dr. Strangelove",
+		Year:  1965,
+		Actor: map[string][]string{
+			"Grace":   {"Tracy Reed", "Miss Scott", "Secretary"},
+			"Muffley": {"Peter Sellers"},
+		},
+		Oscars: []string{"Best Actor", "Best Adapted Screenplay", "Best Director", "Best Picture"},
+		Sequel: &Movie{Title: "Son of Strangelove"},
+	}
+	WriteText(os.Stdout, Diff("x", x, y))
+	// Output:
+	// -(*x).Year = 1964
+	// +(*x).Year = 1965
+	// -(*x).Actor["Grace"][2] = "Foreign Affairs"
+	// +(*x).Actor["Grace"][2] = "Secretary"
+	// -(*x).Actor["Mandrake"] = []string{"Peter Sellers"}
+	// +(*x).Actor["Muffley"] = []string{"Peter Sellers"}
+	// +(*x).Oscars[1] = "Best Adapted Screenplay"
+	// -(*x).Sequel = nil
+	// +(*x).Sequel = &diff.Movie{Title: "Son of Strangelove", Year: 0, Actor: nil, Oscars: nil, Sequel: nil}
+}
+
+func ExampleWriteJSON() {
+	WriteJSON(os.Stdout, Diff("x", []int{1, 2, 3}, []int{1, 3, 4}))
+	// Output:
+	// [
+	// 	{
+	// 		"op": "removed",
+	// 		"path": "x[1]",
+	// 		"old": "2"
+	// 	},
+	// 	{
+	// 		"op": "added",
+	// 		"path": "x[2]",
+	// 		"new": "4"
+	// 	}
+	// ]
+}
+
+// TestLongSlices checks that slices too long to align by their
+// longest common subsequence are compared element by element.
+func TestLongSlices(t *testing.T) {
+	x := make([]int, 2000)
+	y := make([]int, 2001)
+	y[0] = 1
+	got := Diff("x", x, y)
+	want := []Change{
+		{Changed, "x[0]", "0", "1"},
+		{Op: Added, Path: "x[2000]", New: "0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff of long slices = %v, want %v", got, want)
+	}
+}
+
+// P is a pointer type that can refer to itself.
+type P *P
+
+// TestFormatCycles checks that format ends a cycle made only of
+// pointers and interfaces, which maxDepth does not bound.
+func TestFormatCycles(t *testing.T) {
+	var p P
+	p = &p
+	var x interface{}
+	x = &x
+	for _, test := range []struct {
+		x, y interface{}
+		want []Change
+	}{
+		{p, P(nil), []Change{{Changed, "v", "&&...", "nil"}}},
+		{x, (*interface{})(nil), []Change{{Changed, "v", "&&...", "nil"}}},
+	} {
+		if got := Diff("v", test.x, test.y); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Diff(%T) = %v, want %v", test.x, got, test.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	// Circular linked lists a -> b -> a and c -> d -> c.
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b := &link{value: "a"}, &link{value: "b"}
+	a.tail, b.tail = b, a
+	c, d := &link{value: "a"}, &link{value: "B"}
+	c.tail, d.tail = d, c
+
+	var i1, i2 interface{} = 1, "one"
+
+	for _, test := range []struct {
+		x, y interface{}
+		want []Change
+	}{
+		{1, 1, nil},
+		{[]int{1, 2}, []int{1, 2}, nil},
+		{a, a, nil},
+		{a, c, []Change{{Changed, "(*(*x).tail).value", `"b"`, `"B"`}}},
+		{1, "one", []Change{{Changed, "x", "1", `"one"`}}},
+		{&i1, &i2, []Change{{Changed, "(*x)", "1", `"one"`}}},
+		{[]int{1, 2, 3}, []int{0, 1, 2, 3}, []Change{{Op: Added, Path: "x[0]", New: "0"}}},
+		{[]int{1, 2, 3}, []int{1, 3}, []Change{{Op: Removed, Path: "x[1]", Old: "2"}}},
+		{[2]bool{true, false}, [2]bool{true, true}, []Change{{Changed, "x[1]", "false", "true"}}},
+		{map[string]int{"a": 1}, map[string]int(nil), []Change{{Op: Removed, Path: `x["a"]`, Old: "1"}}},
+		{(*int)(nil), new(int), []Change{{Changed, "x", "nil", "&0"}}},
+		{map[int]bool{9: true, 10: true}, map[int]bool{}, []Change{
+			{Op: Removed, Path: "x[9]", Old: "true"},
+			{Op: Removed, Path: "x[10]", Old: "true"},
+		}},
+		{map[int]bool{}, map[int]bool{10: true, 9: false}, []Change{
+			{Op: Added, Path: "x[9]", New: "false"},
+			{Op: Added, Path: "x[10]", New: "true"},
+		}},
+		{map[int]string{}, []map[int]string{{10: "a", 9: "b"}}, []Change{
+			{Changed, "x", "map[int]string{}", "[]map[int]string{map[int]string{9: \"b\", 10: \"a\"}}"},
+		}},
+	} {
+		got := Diff("x", test.x, test.y)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Diff(%v, %v) = %+v, want %+v", test.x, test.y, got, test.want)
+		}
+	}
+}
@@ -125,3 +125,10 @@ type comparison struct {
 }
 
 //!-comparison
+
+// Values is like Equal but compares two reflect.Values, which may
+// have been obtained from unexported struct fields.
+func Values(x, y reflect.Value) bool {
+	seen := make(map[comparison]bool)
+	return equal(x, y, seen)
+}
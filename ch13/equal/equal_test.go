@@ -6,6 +6,8 @@ package equal
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"reflect"
 	"testing"
 )
 
@@ -131,3 +133,92 @@ func Example_equalCycle() {
 	// false
 	// false
 }
+
+func TestEqualOpts(t *testing.T) {
+	type Point struct{ X, Y float64 }
+	type Movie struct {
+		Title  string
+		Year   int
+		Actor  map[string][]string
+		Poster *Point
+		cache  []byte
+	}
+	movie := func() *Movie {
+		return &Movie{
+			Title:  "Dr. Strangelove",
+			Year:   1964,
+			Actor:  map[string][]string{"Grace": {"Tracy Reed"}},
+			Poster: &Point{1, 2},
+		}
+	}
+	recast := movie()
+	recast.Actor["Grace"] = []string{"Tracy Reed", "Keenan Wynn"}
+	cached := movie()
+	cached.cache = []byte("...")
+
+	type link struct {
+		value float64
+		tail  *link
+	}
+	a, b := &link{value: 1}, &link{value: 1.0001}
+	a.tail, b.tail = a, b
+
+	nan, inf := math.NaN(), math.Inf(1)
+	byLength := map[reflect.Type]func(x, y reflect.Value) bool{
+		reflect.TypeOf(""): func(x, y reflect.Value) bool {
+			return x.Len() == y.Len()
+		},
+	}
+
+	for _, test := range []struct {
+		x, y     interface{}
+		opts     Options
+		want     bool
+		wantPath string
+	}{
+		// floats
+		{1.0, 1.0001, Options{}, false, "x"},
+		{1.0, 1.0001, Options{FloatAbs: 1e-3}, true, ""},
+		{1000.0, 1000.1, Options{FloatAbs: 1e-3}, false, "x"},
+		{1000.0, 1000.1, Options{FloatRel: 1e-3}, true, ""},
+		{complex(1, 1), complex(1, 1.0001), Options{FloatAbs: 1e-3}, true, ""},
+		{[]float64{nan}, []float64{nan}, Options{}, false, "x[0]"},
+		{[]float64{nan}, []float64{nan}, Options{NaNEqual: true}, true, ""},
+		{nan, 1.0, Options{NaNEqual: true}, false, "x"},
+		{inf, 1e300, Options{FloatRel: 1e-3}, false, "x"},
+		{inf, -inf, Options{FloatRel: 1e-3}, false, "x"},
+		{-inf, 1.0, Options{FloatAbs: 1e-3, FloatRel: 1e-3}, false, "x"},
+		{inf, inf, Options{FloatRel: 1e-3}, true, ""},
+		// nil and empty
+		{[]int{}, []int(nil), Options{}, false, "x"},
+		{[]int{}, []int(nil), Options{EquateEmpty: true}, true, ""},
+		{map[int]int{}, map[int]int(nil), Options{}, false, "x"},
+		{map[int]int{}, map[int]int(nil), Options{EquateEmpty: true}, true, ""},
+		// paths
+		{movie(), movie(), Options{}, true, ""},
+		{movie(), recast, Options{}, false, `(*x).Actor["Grace"]`},
+		{[]*Point{{1, 2}, {3, 4}}, []*Point{{1, 2}, {3, 5}}, Options{}, false, "(*x[1]).Y"},
+		{map[interface{}]int{1: 1}, map[interface{}]int{1: 2}, Options{}, false, "x[1]"},
+		// ignored fields
+		{movie(), cached, Options{}, false, "(*x).cache"},
+		{movie(), cached, Options{IgnoreFields: []string{"cache"}}, true, ""},
+		{movie(), cached, Options{IgnoreFields: []string{"Movie.cache"}}, true, ""},
+		{movie(), cached, Options{IgnoreFields: []string{"Point.cache"}}, false, "(*x).cache"},
+		{movie(), cached, Options{Ignore: func(t reflect.Type, f reflect.StructField) bool {
+			return f.PkgPath != "" // unexported
+		}}, true, ""},
+		// cycles
+		{a, b, Options{}, false, "(*x).value"},
+		{a, b, Options{FloatAbs: 1e-3}, true, ""},
+		// comparers
+		{[]string{"foo"}, []string{"bar"}, Options{}, false, "x[0]"},
+		{[]string{"foo"}, []string{"bar"}, Options{Comparers: byLength}, true, ""},
+		{[]string{"foo"}, []string{"ba"}, Options{Comparers: byLength}, false, "x[0]"},
+	} {
+		ok, path := EqualOpts(test.x, test.y, test.opts)
+		if ok != test.want || path != test.wantPath {
+			t.Errorf("EqualOpts(%v, %v, %+v) = %t, %q, want %t, %q",
+				test.x, test.y, test.opts, ok, path, test.want, test.wantPath)
+		}
+	}
+}
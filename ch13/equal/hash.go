@@ -0,0 +1,174 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// Hash returns a hash of x that is consistent with Equal:
+// if Equal(x, y), then Hash(x) == Hash(y).
+//
+// Map entries are hashed independently of their order, and, as in
+// Equal, a nil slice or map hashes like an empty one.  Hash does not
+// depend on the seed of the process, so hashes may be stored.
+//
+// Equal considers two cyclic values equal if the infinite trees
+// obtained by following their pointers are equal, so a ring of one
+// element may equal a ring of two.  Hash therefore follows pointers,
+// slices and maps only to a fixed depth, below which all values hash
+// alike, and it remembers the hash of each shared pointer so that
+// values with much sharing take time proportional to their size.
+func Hash(x interface{}) uint64 { return HashValue(reflect.ValueOf(x)) }
+
+// HashValue is like Hash but hashes a reflect.Value, which may have
+// been obtained from an unexported struct field.  It is consistent
+// with Values.
+func HashValue(v reflect.Value) uint64 {
+	if !v.IsValid() {
+		return offset64
+	}
+	h := &hasher{memo: make(map[hashVisit]uint64)}
+	return combine(hashString(offset64, v.Type().String()), h.hash(v, 0))
+}
+
+// maxDepth is the number of pointers, slices and maps that
+// Hash follows from its argument.
+const maxDepth = 16
+
+// A hashVisit identifies the hash of a value that a pointer
+// refers to, at a given depth.
+type hashVisit struct {
+	ptr   unsafe.Pointer
+	t     reflect.Type
+	depth int
+}
+
+type hasher struct {
+	memo map[hashVisit]uint64
+}
+
+// The FNV-1a parameters.
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// combine mixes the 8 bytes of x into the FNV-1a hash h.
+func combine(h, x uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= x & 0xff
+		h *= prime64
+		x >>= 8
+	}
+	return h
+}
+
+func hashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
+}
+
+func hashFloat(f float64) uint64 {
+	if f == 0 {
+		return 0 // -0 == +0
+	}
+	return math.Float64bits(f) // NaN is never equal, so any hash will do
+}
+
+// hash returns the hash of v, which is depth pointers, slices
+// and maps away from the argument of Hash.
+func (h *hasher) hash(v reflect.Value, depth int) uint64 {
+	k := uint64(v.Kind())
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return combine(k, 1)
+		}
+		return combine(k, 0)
+
+	case reflect.String:
+		return hashString(combine(offset64, k), v.String())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return combine(k, uint64(v.Int()))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return combine(k, v.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		return combine(k, hashFloat(v.Float()))
+
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return combine(combine(k, hashFloat(real(c))), hashFloat(imag(c)))
+
+	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
+		return combine(k, uint64(v.Pointer()))
+
+	case reflect.Ptr:
+		if v.IsNil() || depth == maxDepth {
+			return k
+		}
+		hv := hashVisit{unsafe.Pointer(v.Pointer()), v.Type(), depth}
+		if x, ok := h.memo[hv]; ok {
+			return x
+		}
+		x := combine(k, h.hash(v.Elem(), depth+1))
+		h.memo[hv] = x
+		return x
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return k
+		}
+		e := v.Elem()
+		return combine(hashString(k, e.Type().String()), h.hash(e, depth))
+
+	case reflect.Array:
+		x := k
+		for i := 0; i < v.Len(); i++ {
+			x = combine(x, h.hash(v.Index(i), depth))
+		}
+		return x
+
+	case reflect.Slice:
+		x := combine(k, uint64(v.Len()))
+		if depth == maxDepth {
+			return x
+		}
+		for i := 0; i < v.Len(); i++ {
+			x = combine(x, h.hash(v.Index(i), depth+1))
+		}
+		return x
+
+	case reflect.Struct:
+		x := k
+		for i, n := 0, v.NumField(); i < n; i++ {
+			x = combine(x, h.hash(v.Field(i), depth))
+		}
+		return x
+
+	case reflect.Map:
+		x := combine(k, uint64(v.Len()))
+		if depth == maxDepth {
+			return x
+		}
+		// Sum the hashes of the entries, so that their order
+		// does not matter.
+		var sum uint64
+		for _, key := range v.MapKeys() {
+			sum += combine(h.hash(key, depth+1), h.hash(v.MapIndex(key), depth+1))
+		}
+		return combine(x, sum)
+	}
+	panic("unreachable")
+}
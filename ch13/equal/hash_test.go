@@ -0,0 +1,153 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+type node struct {
+	Name  string
+	F     float64
+	Tags  []string
+	Attrs map[string]int
+	Any   interface{}
+	Next  *node
+	Kids  []*node
+}
+
+// randomNode returns a random graph of nodes, which may share
+// nodes and contain cycles.  Two calls with the same seed return
+// equal graphs, but if alt is set, the second is built differently:
+// empty slices and maps are nil, maps are filled in the opposite
+// order, and zero floats are negative.
+func randomNode(seed int64, alt bool) *node {
+	r := rand.New(rand.NewSource(seed))
+	var nodes []*node
+	var gen func(depth int) *node
+	gen = func(depth int) *node {
+		if len(nodes) > 0 && r.Intn(4) == 0 {
+			return nodes[r.Intn(len(nodes))] // shared, perhaps cyclic
+		}
+		n := &node{Name: string(rune('a' + r.Intn(3)))}
+		nodes = append(nodes, n)
+		n.F = float64(r.Intn(3))
+		if alt && n.F == 0 {
+			n.F = math.Copysign(0, -1)
+		}
+		n.Tags = make([]string, r.Intn(3))
+		for i := range n.Tags {
+			n.Tags[i] = string(rune('x' + r.Intn(2)))
+		}
+		keys := make([]string, r.Intn(4))
+		for i := range keys {
+			keys[i] = string(rune('p' + i))
+		}
+		n.Attrs = make(map[string]int)
+		if alt {
+			for i := len(keys) - 1; i >= 0; i-- {
+				n.Attrs[keys[i]] = i
+			}
+		} else {
+			for i, k := range keys {
+				n.Attrs[k] = i
+			}
+		}
+		if alt && len(n.Tags) == 0 {
+			n.Tags = nil
+		}
+		if alt && len(n.Attrs) == 0 {
+			n.Attrs = nil
+		}
+		switch r.Intn(3) {
+		case 1:
+			n.Any = r.Intn(2)
+		case 2:
+			n.Any = []int{r.Intn(2)}
+		}
+		if depth < 4 {
+			if r.Intn(2) == 0 {
+				n.Next = gen(depth + 1)
+			}
+			for i := r.Intn(3); i > 0; i-- {
+				n.Kids = append(n.Kids, gen(depth+1))
+			}
+		}
+		return n
+	}
+	return gen(0)
+}
+
+// TestHashEqual checks that values built alike, which are Equal,
+// have equal hashes.
+func TestHashEqual(t *testing.T) {
+	f := func(seed int64) bool {
+		x, y := randomNode(seed, false), randomNode(seed, true)
+		if !Equal(x, y) {
+			t.Errorf("seed %d: values built alike are not Equal", seed)
+			return false
+		}
+		return Hash(x) == Hash(y)
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestHashConsistent checks that Equal implies equal hashes
+// for independent random values, which are often Equal.
+func TestHashConsistent(t *testing.T) {
+	var equals int
+	f := func(seed1, seed2 int8) bool {
+		x, y := randomNode(int64(seed1), false), randomNode(int64(seed2), true)
+		if !Equal(x, y) {
+			return true
+		}
+		equals++
+		return Hash(x) == Hash(y)
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+	if equals == 0 {
+		t.Errorf("no Equal pairs were generated")
+	}
+}
+
+func TestHash(t *testing.T) {
+	// Rings of one and two elements with the same values are Equal.
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b, c := &link{value: "v"}, &link{value: "v"}, &link{value: "v"}
+	a.tail, b.tail, c.tail = b, a, c
+	if !Equal(a, c) || Hash(a) != Hash(c) {
+		t.Errorf("Equal(a, c) = %t, Hash(a) = %x, Hash(c) = %x",
+			Equal(a, c), Hash(a), Hash(c))
+	}
+
+	type CycleSlice []CycleSlice
+	var cycleSlice CycleSlice
+	cycleSlice = append(cycleSlice, cycleSlice)
+	Hash(cycleSlice) // must terminate
+
+	for _, test := range []struct{ x, y interface{} }{
+		{1, 2},
+		{1, int64(1)},
+		{"foo", "bar"},
+		{[]int{1, 2}, []int{2, 1}},
+		{map[string]int{"a": 1}, map[string]int{"a": 2}},
+		{map[string]int{"a": 1, "b": 2}, map[string]int{"a": 2, "b": 1}},
+		{[]interface{}{1}, []interface{}{int8(1)}},
+		{a, &link{value: "w"}},
+	} {
+		if Hash(test.x) == Hash(test.y) {
+			t.Errorf("Hash(%#v) == Hash(%#v)", test.x, test.y)
+		}
+	}
+}
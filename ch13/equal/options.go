@@ -0,0 +1,217 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package equal
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// Options configures EqualOpts.  The zero Options compares like
+// Equal, except that a nil slice or map does not equal an empty one.
+type Options struct {
+	// Floats (and the parts of complex numbers) are equal if they
+	// differ by at most FloatAbs, or by at most FloatRel times the
+	// larger of their magnitudes.  An infinity equals only itself.
+	FloatAbs, FloatRel float64
+
+	// NaNEqual makes NaN equal to NaN.
+	NaNEqual bool
+
+	// IgnoreFields names struct fields that are not compared,
+	// either as "Name", for a field of any struct type, or as
+	// "Type.Name", for a field of the named struct type Type.
+	IgnoreFields []string
+
+	// Ignore, if non-nil, reports whether field f of struct type t
+	// should not be compared.
+	Ignore func(t reflect.Type, f reflect.StructField) bool
+
+	// EquateEmpty makes a nil slice or map equal to an empty one.
+	EquateEmpty bool
+
+	// Comparers maps a type to a function that reports whether
+	// two values of that type are equal, in place of the
+	// comparison by kind.
+	Comparers map[reflect.Type]func(x, y reflect.Value) bool
+}
+
+// EqualOpts reports whether x and y are deeply equal under opts.
+// If they are not, path is the path of the first mismatch, in the
+// syntax of gopl.io/ch12/display, such as (*x).Actor["Grace"][2];
+// x stands for both values.
+func EqualOpts(x, y interface{}, opts Options) (ok bool, path string) {
+	c := &comparer{opts: &opts, seen: make(map[comparison]bool)}
+	if c.equal(reflect.ValueOf(x), reflect.ValueOf(y)) {
+		return true, ""
+	}
+	// The steps were recorded from the mismatch back to the root.
+	path = "x"
+	for i := len(c.steps) - 1; i >= 0; i-- {
+		if s := c.steps[i]; s == "*" {
+			path = "(*" + path + ")"
+		} else {
+			path += s
+		}
+	}
+	return false, path
+}
+
+type comparer struct {
+	opts  *Options
+	seen  map[comparison]bool
+	steps []string // path to the mismatch, innermost step first
+}
+
+// fail records step as part of the path to a mismatch
+// and returns false.
+func (c *comparer) fail(step string) bool {
+	c.steps = append(c.steps, step)
+	return false
+}
+
+func (c *comparer) equal(x, y reflect.Value) bool {
+	if !x.IsValid() || !y.IsValid() {
+		return x.IsValid() == y.IsValid()
+	}
+	if x.Type() != y.Type() {
+		return false
+	}
+	if eq := c.opts.Comparers[x.Type()]; eq != nil {
+		return eq(x, y)
+	}
+
+	// cycle check
+	if x.CanAddr() && y.CanAddr() {
+		xptr := unsafe.Pointer(x.UnsafeAddr())
+		yptr := unsafe.Pointer(y.UnsafeAddr())
+		if xptr == yptr {
+			return true // identical references
+		}
+		cmp := comparison{xptr, yptr, x.Type()}
+		if c.seen[cmp] {
+			return true // already seen
+		}
+		c.seen[cmp] = true
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		return x.Bool() == y.Bool()
+
+	case reflect.String:
+		return x.String() == y.String()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return x.Int() == y.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return x.Uint() == y.Uint()
+
+	case reflect.Float32, reflect.Float64:
+		return c.floatEqual(x.Float(), y.Float())
+
+	case reflect.Complex64, reflect.Complex128:
+		xc, yc := x.Complex(), y.Complex()
+		return c.floatEqual(real(xc), real(yc)) && c.floatEqual(imag(xc), imag(yc))
+
+	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
+		return x.Pointer() == y.Pointer()
+
+	case reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return c.equal(x.Elem(), y.Elem()) || c.fail("*")
+
+	case reflect.Interface:
+		return c.equal(x.Elem(), y.Elem())
+
+	case reflect.Array, reflect.Slice:
+		if x.Kind() == reflect.Slice && !c.opts.EquateEmpty && x.IsNil() != y.IsNil() {
+			return false
+		}
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !c.equal(x.Index(i), y.Index(i)) {
+				return c.fail(fmt.Sprintf("[%d]", i))
+			}
+		}
+		return true
+
+	case reflect.Struct:
+		t := x.Type()
+		for i, n := 0, x.NumField(); i < n; i++ {
+			f := t.Field(i)
+			if c.ignore(t, f) {
+				continue
+			}
+			if !c.equal(x.Field(i), y.Field(i)) {
+				return c.fail("." + f.Name)
+			}
+		}
+		return true
+
+	case reflect.Map:
+		if !c.opts.EquateEmpty && x.IsNil() != y.IsNil() {
+			return false
+		}
+		if x.Len() != y.Len() {
+			return false
+		}
+		for _, k := range x.MapKeys() {
+			if !c.equal(x.MapIndex(k), y.MapIndex(k)) {
+				return c.fail("[" + formatKey(k) + "]")
+			}
+		}
+		return true
+	}
+	panic("unreachable")
+}
+
+func (c *comparer) floatEqual(x, y float64) bool {
+	if x == y {
+		return true
+	}
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return c.opts.NaNEqual && math.IsNaN(x) && math.IsNaN(y)
+	}
+	if math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return false // an infinity is within no tolerance of another value
+	}
+	diff := math.Abs(x - y)
+	return diff <= c.opts.FloatAbs ||
+		diff <= c.opts.FloatRel*math.Max(math.Abs(x), math.Abs(y))
+}
+
+// ignore reports whether field f of struct type t is not compared.
+func (c *comparer) ignore(t reflect.Type, f reflect.StructField) bool {
+	for _, name := range c.opts.IgnoreFields {
+		if name == f.Name || t.Name() != "" && name == t.Name()+"."+f.Name {
+			return true
+		}
+	}
+	return c.opts.Ignore != nil && c.opts.Ignore(t, f)
+}
+
+// formatKey formats a map key for a path: strings are quoted,
+// and other keys are formatted by %v.
+func formatKey(k reflect.Value) string {
+	if k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
+	}
+	if k.Kind() == reflect.String {
+		return fmt.Sprintf("%q", k.String())
+	}
+	if k.CanInterface() {
+		return fmt.Sprintf("%v", k.Interface())
+	}
+	return k.Type().String() + " value"
+}
@@ -0,0 +1,231 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A layout describes the memory layout of a named struct type.
+type layout struct {
+	name    string
+	size    int64
+	align   int64
+	padding int64 // total padding bytes
+	fields  []field
+
+	order   []int // the fields in an order that minimises padding
+	optSize int64 // the size of the struct in that order
+}
+
+// A field describes one field of a struct, as unsafe.Offsetof,
+// unsafe.Sizeof and unsafe.Alignof would for the target platform.
+type field struct {
+	v       *types.Var
+	offset  int64
+	size    int64
+	align   int64
+	padding int64      // padding bytes before the field
+	ast     *ast.Field // the declaration of the field, among others
+}
+
+// analyze returns the layouts of the named struct types declared
+// at package level in files, in order of declaration.
+// Generic types, whose layout depends on their type arguments,
+// and types with fields of C types, which are unknown without cgo,
+// are skipped.
+func analyze(files []*ast.File, pkg *types.Package, sizes types.Sizes) []*layout {
+	var layouts []*layout
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok || spec.TypeParams != nil || spec.Assign.IsValid() {
+					continue
+				}
+				obj := pkg.Scope().Lookup(spec.Name.Name)
+				if obj == nil {
+					continue
+				}
+				t, ok := obj.Type().Underlying().(*types.Struct)
+				if !ok || hasInvalid(t) {
+					continue
+				}
+				l := analyzeStruct(t, sizes)
+				l.name = spec.Name.Name
+				l.setDecls(st)
+				layouts = append(layouts, l)
+			}
+		}
+	}
+	return layouts
+}
+
+// hasInvalid reports whether a field of t, or of a struct or
+// array type within it, has an invalid type.
+func hasInvalid(t types.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		return t.Kind() == types.Invalid
+	case *types.Array:
+		return hasInvalid(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasInvalid(t.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// analyzeStruct returns the layout of t, and an order
+// of its fields that minimises padding.
+func analyzeStruct(t *types.Struct, sizes types.Sizes) *layout {
+	l := &layout{size: sizes.Sizeof(t), align: sizes.Alignof(t)}
+	vars := make([]*types.Var, t.NumFields())
+	for i := range vars {
+		vars[i] = t.Field(i)
+	}
+	offsets := sizes.Offsetsof(vars)
+	var end, used int64 // end of the previous field; bytes in fields
+	for i, v := range vars {
+		f := field{
+			v:      v,
+			offset: offsets[i],
+			size:   sizes.Sizeof(v.Type()),
+			align:  sizes.Alignof(v.Type()),
+		}
+		f.padding = f.offset - end
+		used += f.size
+		end = f.offset + f.size
+		l.fields = append(l.fields, f)
+	}
+	l.padding = l.size - used
+
+	// Zero-sized fields go first, since a final zero-sized field
+	// is padded so that its address is within the struct; then
+	// the fields with the strictest alignment go first, and the
+	// larger of those first.  As every size is a multiple of its
+	// alignment, this leaves padding only at the end.
+	l.order = make([]int, len(vars))
+	for i := range l.order {
+		l.order[i] = i
+	}
+	sort.SliceStable(l.order, func(i, j int) bool {
+		x, y := l.fields[l.order[i]], l.fields[l.order[j]]
+		if (x.size == 0) != (y.size == 0) {
+			return x.size == 0
+		}
+		if x.align != y.align {
+			return x.align > y.align
+		}
+		return x.size > y.size
+	})
+	reordered := make([]*types.Var, len(vars))
+	tags := make([]string, len(vars))
+	for i, j := range l.order {
+		reordered[i], tags[i] = vars[j], t.Tag(j)
+	}
+	l.optSize = sizes.Sizeof(types.NewStruct(reordered, tags))
+	if l.optSize >= l.size {
+		// Keep the declared order if it is already optimal.
+		for i := range l.order {
+			l.order[i] = i
+		}
+		l.optSize = l.size
+	}
+	return l
+}
+
+// setDecls records the declaration of each field of l.
+func (l *layout) setDecls(st *ast.StructType) {
+	i := 0
+	for _, f := range st.Fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1 // embedded
+		}
+		for ; n > 0; n-- {
+			l.fields[i].ast = f
+			i++
+		}
+	}
+}
+
+// print writes a report of the layout of l to w:
+//
+//	Movie: size 40, align 8, padding 14
+//	     0  Released  bool    size 1, align 1
+//	     8  Year      int     size 8, align 8, 7 bytes of padding before
+//	  ...
+//	  optimal order: size 32, saves 8 bytes
+//	     Title Year Released Color
+func (l *layout) print(w io.Writer, qual types.Qualifier) {
+	fmt.Fprintf(w, "%s: size %d, align %d, padding %d\n", l.name, l.size, l.align, l.padding)
+	tw := new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', 0)
+	for _, f := range l.fields {
+		fmt.Fprintf(tw, "%6d  %s\t%s\tsize %d, align %d",
+			f.offset, f.v.Name(), types.TypeString(f.v.Type(), qual), f.size, f.align)
+		if f.padding > 0 {
+			fmt.Fprintf(tw, ", %d bytes of padding before", f.padding)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	if l.optSize < l.size {
+		fmt.Fprintf(w, "  optimal order: size %d, saves %d bytes\n    ", l.optSize, l.size-l.optSize)
+		for _, j := range l.order {
+			fmt.Fprint(w, " ", l.fields[j].v.Name())
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// rewrite returns the declaration of l with its fields in the
+// optimal order, formatted by gofmt.  A declaration of several
+// fields, such as "X, Y int", is split into one per field.
+// Field comments are kept; comments between fields are not.
+// src is the source of the file that declares l.
+func (l *layout) rewrite(fset *token.FileSet, src []byte) ([]byte, error) {
+	text := func(n ast.Node) string {
+		start, end := fset.Position(n.Pos()).Offset, fset.Position(n.End()).Offset
+		return string(src[start:end])
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s struct {\n", l.name)
+	for _, j := range l.order {
+		f := l.fields[j]
+		if f.ast.Doc != nil {
+			buf.WriteString(text(f.ast.Doc) + "\n")
+		}
+		if len(f.ast.Names) > 0 {
+			buf.WriteString(f.v.Name() + " ")
+		}
+		buf.WriteString(text(f.ast.Type))
+		if f.ast.Tag != nil {
+			buf.WriteString(" " + f.ast.Tag.Value)
+		}
+		if f.ast.Comment != nil {
+			buf.WriteString(" " + strings.TrimSpace(text(f.ast.Comment)))
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,142 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+const src = `package p
+
+type Movie struct {
+	Released bool
+	Year     int
+	// Color is false for black and white.
+	Color bool
+	Title string ` + "`json:\"title\"`" + ` // the original title
+}
+
+type Point struct{ X, Y int }
+
+type Sparse struct {
+	A    byte
+	B, C int32
+	D    byte
+	E    struct{}
+}
+
+type Pair[T any] struct{ X, Y T }
+`
+
+// The types of src, as compiled for this platform.
+type (
+	Movie struct {
+		Released bool
+		Year     int
+		Color    bool
+		Title    string
+	}
+	Point  struct{ X, Y int }
+	Sparse struct {
+		A    byte
+		B, C int32
+		D    byte
+		E    struct{}
+	}
+)
+
+func check(t *testing.T) (*token.FileSet, map[string]*layout) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := types.SizesFor("gc", runtime.GOARCH)
+	conf := types.Config{Importer: importer.Default(), Sizes: sizes}
+	files := []*ast.File{f}
+	pkg, err := conf.Check("p", fset, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layouts := make(map[string]*layout)
+	for _, l := range analyze(files, pkg, sizes) {
+		layouts[l.name] = l
+	}
+	return fset, layouts
+}
+
+func TestAnalyze(t *testing.T) {
+	_, layouts := check(t)
+	if _, ok := layouts["Pair"]; ok {
+		t.Errorf("generic type Pair was analyzed")
+	}
+	for _, x := range []interface{}{Movie{}, Point{}, Sparse{}} {
+		rt := reflect.TypeOf(x)
+		l := layouts[rt.Name()]
+		if l == nil {
+			t.Errorf("%s was not analyzed", rt.Name())
+			continue
+		}
+		if l.size != int64(rt.Size()) || l.align != int64(rt.Align()) {
+			t.Errorf("%s: size %d, align %d, want %d, %d",
+				rt.Name(), l.size, l.align, rt.Size(), rt.Align())
+		}
+		for i, f := range l.fields {
+			rf := rt.Field(i)
+			if f.v.Name() != rf.Name || f.offset != int64(rf.Offset) ||
+				f.size != int64(rf.Type.Size()) || f.align != int64(rf.Type.Align()) {
+				t.Errorf("%s.%s: offset %d, size %d, align %d, want %d, %d, %d",
+					rt.Name(), f.v.Name(), f.offset, f.size, f.align,
+					rf.Offset, rf.Type.Size(), rf.Type.Align())
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name    string
+		optSize int64
+		order   []string
+	}{
+		{"Movie", 32, []string{"Title", "Year", "Released", "Color"}},
+		{"Point", 16, []string{"X", "Y"}},
+		{"Sparse", 12, []string{"E", "B", "C", "A", "D"}},
+	} {
+		l := layouts[test.name]
+		var order []string
+		for _, i := range l.order {
+			order = append(order, l.fields[i].v.Name())
+		}
+		if runtime.GOARCH == "amd64" && l.optSize != test.optSize {
+			t.Errorf("%s: optimal size %d, want %d", test.name, l.optSize, test.optSize)
+		}
+		if !reflect.DeepEqual(order, test.order) {
+			t.Errorf("%s: optimal order %v, want %v", test.name, order, test.order)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	fset, layouts := check(t)
+	got, err := layouts["Movie"].rewrite(fset, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "type Movie struct {\n" +
+		"\tTitle    string `json:\"title\"` // the original title\n" +
+		"\tYear     int\n" +
+		"\tReleased bool\n" +
+		"\t// Color is false for black and white.\n" +
+		"\tColor bool\n" +
+		"}\n"
+	if string(got) != want {
+		t.Errorf("rewrite(Movie) = \n%s\nwant\n%s", got, want)
+	}
+}
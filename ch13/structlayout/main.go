@@ -0,0 +1,149 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+// Structlayout reports the memory layout of the struct types of a
+// package: for each named struct type, its size and alignment, the
+// offset, size and alignment of each field, and the padding between
+// them, as unsafe.Sizeof, Alignof and Offsetof would report them.
+// If reordering the fields would save space, it suggests an order
+// that minimises padding.
+//
+// Usage:
+//
+//	structlayout [-arch arch] [-waste] [-rewrite] package [type ...]
+//
+// With -waste, only the types that reordering would shrink are
+// reported.  With -rewrite, structlayout prints the declarations of
+// those types with their fields reordered, instead of a report.
+//
+//	$ structlayout -waste ./testdata/movie
+//	Movie: size 40, align 8, padding 14
+//	     0  Released  bool    size 1, align 1
+//	     8  Year      int     size 8, align 8, 7 bytes of padding before
+//	    16  Color     bool    size 1, align 1
+//	    24  Title     string  size 16, align 8, 7 bytes of padding before
+//	  optimal order: size 32, saves 8 bytes
+//	     Title Year Released Color
+//	...
+//	$ structlayout -rewrite ./testdata/movie Movie
+//	type Movie struct {
+//		Title    string `json:"title"` // the original title
+//		Year     int
+//		Released bool
+//		// Color is false for black and white.
+//		Color bool
+//	}
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	arch    = flag.String("arch", build.Default.GOARCH, "target architecture")
+	waste   = flag.Bool("waste", false, "report only types that reordering would shrink")
+	rewrite = flag.Bool("rewrite", false, "print reordered declarations")
+)
+
+func main() {
+	log.SetPrefix("structlayout: ")
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: structlayout [flags] package [type ...]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	sizes := types.SizesFor("gc", *arch)
+	if sizes == nil {
+		log.Fatalf("unknown architecture %s", *arch)
+	}
+	// The source importer checks dependencies for build.Default,
+	// whose tool tags, such as amd64.v1, belong to the host.
+	if *arch != build.Default.GOARCH {
+		build.Default.GOARCH = *arch
+		build.Default.ToolTags = nil
+	}
+	fset := token.NewFileSet()
+	files, srcs, err := parsePackage(fset, flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf := types.Config{
+		Importer:    importer.ForCompiler(fset, "source", nil),
+		Sizes:       sizes,
+		FakeImportC: true,
+	}
+	pkg, err := conf.Check(flag.Arg(0), fset, files, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	only := make(map[string]bool)
+	for _, name := range flag.Args()[1:] {
+		only[name] = true
+	}
+	qual := types.RelativeTo(pkg)
+	sep := ""
+	for _, l := range analyze(files, pkg, sizes) {
+		if len(only) > 0 && !only[l.name] {
+			continue
+		}
+		if (*waste || *rewrite) && l.optSize == l.size {
+			continue
+		}
+		fmt.Print(sep)
+		sep = "\n"
+		if !*rewrite {
+			l.print(os.Stdout, qual)
+			continue
+		}
+		file := fset.File(l.fields[0].ast.Pos())
+		decl, err := l.rewrite(fset, srcs[file.Name()])
+		if err != nil {
+			log.Fatalf("rewriting %s: %v", l.name, err)
+		}
+		os.Stdout.Write(decl)
+	}
+}
+
+// parsePackage parses the Go files of the package with the given
+// import path, or in the given directory, and returns them and
+// their sources, keyed by file name.
+func parsePackage(fset *token.FileSet, path string) ([]*ast.File, map[string][]byte, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	bp, err := build.Import(path, cwd, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []*ast.File
+	srcs := make(map[string][]byte)
+	for _, name := range append(bp.GoFiles, bp.CgoFiles...) {
+		filename := filepath.Join(bp.Dir, name)
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+		srcs[filename] = src
+	}
+	return files, srcs, nil
+}
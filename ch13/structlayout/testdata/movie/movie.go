@@ -0,0 +1,21 @@
+// Package movie declares struct types for the tests of structlayout.
+package movie
+
+// Movie wastes 14 bytes in padding.
+type Movie struct {
+	Released bool
+	Year     int
+	// Color is false for black and white.
+	Color bool
+	Title string `json:"title"` // the original title
+}
+
+// Point is already optimal.
+type Point struct{ X, Y int }
+
+type Sparse struct {
+	A    byte
+	B, C int32
+	D    byte
+	E    struct{}
+}
@@ -0,0 +1,190 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo
+
+import (
+	"context"
+	"time"
+)
+
+// Options bounds the size of a Memo with values of type V and the
+// lifetime of its entries.  The zero Options keeps every entry forever.
+type Options[V any] struct {
+	// If MaxEntries or MaxBytes is positive, the memo evicts the
+	// least recently used entries to keep the number of entries,
+	// or their total size, within it.  Entries whose values are
+	// still being computed are never evicted.
+	MaxEntries int
+	MaxBytes   int64
+
+	// Size returns the size of a value, for MaxBytes.
+	// If nil, the size of a []byte or string is its length,
+	// and that of any other value is 1.
+	Size func(value V) int64
+
+	// If TTL is positive, an entry expires TTL after its value
+	// is computed.  A request for an expired entry computes its
+	// value anew; but for Stale after it expires, the request
+	// returns the stale value at once, and the value is computed
+	// anew in the background.
+	TTL   time.Duration
+	Stale time.Duration
+
+	// Errors says what to do with a transient error of Func: one
+	// that Permanent, if non-nil, does not report as permanent.
+	// A permanent error is cached like a value, and never retried.
+	Errors ErrorPolicy
+
+	// ErrorTTL is how long ExpireErrors caches a transient error.
+	ErrorTTL time.Duration
+
+	// RetryErrors retries a call up to Retries times, waiting
+	// Backoff before the first retry and twice as long before
+	// each next one.  The requests for the key share the retries.
+	Retries int
+	Backoff time.Duration
+
+	Permanent func(err error) bool
+}
+
+// An ErrorPolicy says what a Memo does with transient errors.
+type ErrorPolicy int
+
+const (
+	CacheErrors   ErrorPolicy = iota // cache them like values
+	NoCacheErrors                    // return them, but don't cache them
+	ExpireErrors                     // cache them for ErrorTTL
+	RetryErrors                      // retry, and don't cache the last error
+)
+
+// transient reports whether err is an error that opts.Errors applies to.
+func (opts *Options[V]) transient(err error) bool {
+	return err != nil && (opts.Permanent == nil || !opts.Permanent(err))
+}
+
+// cacheable reports whether a result with error err may be cached.
+func (opts *Options[V]) cacheable(err error) bool {
+	return !opts.transient(err) ||
+		opts.Errors != NoCacheErrors && opts.Errors != RetryErrors
+}
+
+// expiry returns the time at which a result with error err
+// expires, or the zero Time if it never does.
+func (opts *Options[V]) expiry(err error) time.Time {
+	switch {
+	case opts.transient(err) && opts.Errors == ExpireErrors:
+		return time.Now().Add(opts.ErrorTTL)
+	case opts.TTL > 0:
+		return time.Now().Add(opts.TTL)
+	}
+	return time.Time{}
+}
+
+// retrying returns f, retrying its transient errors if opts says so.
+func retrying[K comparable, V any](opts *Options[V], f Func[K, V]) Func[K, V] {
+	if opts.Errors != RetryErrors {
+		return f
+	}
+	return func(ctx context.Context, key K) (V, error) {
+		backoff := opts.Backoff
+		for retry := 0; ; retry++ {
+			value, err := f(ctx, key)
+			if !opts.transient(err) || retry == opts.Retries {
+				return value, err
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return value, err
+			}
+			backoff *= 2
+		}
+	}
+}
+
+func (opts *Options[V]) size(value V) int64 {
+	if opts.Size != nil {
+		return opts.Size(value)
+	}
+	switch value := any(value).(type) {
+	case []byte:
+		return int64(len(value))
+	case string:
+		return int64(len(value))
+	}
+	return 1
+}
+
+// add caches e, whose value is ready, and evicts the least recently
+// used entries while the cache is too large.
+// The caller must hold memo.mu.
+func (memo *Memo[K, V]) add(e *entry[K, V]) {
+	e.size = memo.opts.size(e.res.value)
+	e.expires = memo.opts.expiry(e.res.err)
+	e.elem = memo.lru.PushFront(e)
+	memo.bytes += e.size
+	for memo.lru.Len() > 0 &&
+		(memo.opts.MaxEntries > 0 && memo.lru.Len() > memo.opts.MaxEntries ||
+			memo.opts.MaxBytes > 0 && memo.bytes > memo.opts.MaxBytes) {
+		memo.remove(memo.lru.Back().Value.(*entry[K, V]))
+	}
+}
+
+// remove removes e from the cache, unless a new entry for
+// its key has already replaced it, and from the LRU list.
+// The caller must hold memo.mu.
+func (memo *Memo[K, V]) remove(e *entry[K, V]) {
+	if memo.cache[e.key] == e {
+		delete(memo.cache, e.key)
+	}
+	if e.elem != nil {
+		memo.lru.Remove(e.elem)
+		memo.bytes -= e.size
+		e.elem = nil
+	}
+}
+
+// expired reports whether the cached entry e must be computed anew.
+// If e is stale, expired starts to refresh it and reports false.
+// The caller must hold memo.mu.
+func (memo *Memo[K, V]) expired(e *entry[K, V]) bool {
+	if e.expires.IsZero() {
+		return false
+	}
+	now := time.Now()
+	if now.Before(e.expires) {
+		return false
+	}
+	if e.res.err == nil && now.Before(e.expires.Add(memo.opts.Stale)) {
+		if !e.refreshing {
+			e.refreshing = true
+			memo.stats.started()
+			go memo.refresh(e)
+		}
+		return false
+	}
+	memo.remove(e)
+	return true
+}
+
+// refresh computes the value of the stale entry e anew, and
+// replaces e by a new entry if that succeeds.
+func (memo *Memo[K, V]) refresh(e *entry[K, V]) {
+	start := time.Now()
+	value, err := memo.f(context.Background(), e.key)
+	memo.stats.finished(start, err, false)
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	e.refreshing = false
+	if err != nil || memo.cache[e.key] != e {
+		return // keep the stale value, or a newer one
+	}
+	fresh := &entry[K, V]{key: e.key, res: result[V]{value, nil}, ready: make(chan struct{}), cancel: func() {}}
+	close(fresh.ready)
+	memo.remove(e)
+	memo.cache[e.key] = fresh
+	memo.add(fresh)
+}
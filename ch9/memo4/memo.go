@@ -7,55 +7,146 @@
 // a function.  Requests for different keys proceed in parallel.
 // Concurrent requests for the same key block until the first completes.
 // This implementation uses a Mutex.
+//
+// A request may be cancelled through its context.  A call of the
+// function is cancelled when every request waiting for it has been,
+// and its result is not cached.
+//
+// By default the memo keeps every entry forever; NewWithOptions
+// bounds the number or size of its entries and expires them,
+// and says whether to cache or retry the errors of the function.
+// Stats reports how effective the memo is, and Publish publishes
+// that through expvar.
 package memo
 
-import "sync"
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
 
 // Func is the type of the function to memoize.
-type Func func(string) (interface{}, error)
+// It should return promptly when ctx is done.
+type Func[K comparable, V any] func(ctx context.Context, key K) (V, error)
 
-type result struct {
-	value interface{}
+type result[V any] struct {
+	value V
 	err   error
 }
 
 //!+
-type entry struct {
-	res   result
+type entry[K comparable, V any] struct {
+	res   result[V]
 	ready chan struct{} // closed when res is ready
+
+	key    K
+	cancel context.CancelFunc // cancels the call of Func
+
+	// These fields are guarded by Memo.mu.
+	waiters    int           // requests waiting for res
+	elem       *list.Element // in Memo.lru, once res is ready and cached
+	size       int64         // of res.value, once cached
+	expires    time.Time     // once cached, if Options.TTL is set
+	refreshing bool          // a refresh of a stale value is in progress
 }
 
-func New(f Func) *Memo {
-	return &Memo{f: f, cache: make(map[string]*entry)}
+func New[K comparable, V any](f func(context.Context, K) (V, error)) *Memo[K, V] {
+	return NewWithOptions(f, Options[V]{})
 }
 
-type Memo struct {
-	f     Func
-	mu    sync.Mutex // guards cache
-	cache map[string]*entry
+// NewWithOptions returns a memoization of f that
+// bounds and expires its entries as opts specifies.
+func NewWithOptions[K comparable, V any](f func(context.Context, K) (V, error), opts Options[V]) *Memo[K, V] {
+	return &Memo[K, V]{
+		f:     retrying(&opts, f),
+		opts:  opts,
+		cache: make(map[K]*entry[K, V]),
+		lru:   list.New(),
+	}
 }
 
-func (memo *Memo) Get(key string) (value interface{}, err error) {
+type Memo[K comparable, V any] struct {
+	f     Func[K, V]
+	opts  Options[V]
+	mu    sync.Mutex // guards cache, lru and bytes
+	cache map[K]*entry[K, V]
+	lru   *list.List // of cached entries, most recently used first
+	bytes int64      // total size of cached entries
+	stats recorder
+}
+
+// Get returns the result of f(key), calling f if needed,
+// or ctx.Err() if ctx is done first.
+func (memo *Memo[K, V]) Get(ctx context.Context, key K) (value V, err error) {
+	if err = ctx.Err(); err != nil {
+		return value, err
+	}
+	defer memo.stats.got(time.Now())
 	memo.mu.Lock()
 	e := memo.cache[key]
+	if e != nil && e.elem != nil && memo.expired(e) {
+		e = nil
+	}
+	memo.stats.request(e != nil && e.elem != nil)
 	if e == nil {
 		// This is the first request for this key.
-		// This goroutine becomes responsible for computing
-		// the value and broadcasting the ready condition.
-		e = &entry{ready: make(chan struct{})}
+		// A new goroutine becomes responsible for computing
+		// the value and broadcasting the ready condition,
+		// so that this request can give up on it.
+		callCtx, cancel := context.WithCancel(context.Background())
+		e = &entry[K, V]{key: key, ready: make(chan struct{}), cancel: cancel}
 		memo.cache[key] = e
-		memo.mu.Unlock()
+		memo.stats.started()
+		go memo.call(callCtx, e)
+	} else if e.elem != nil {
+		memo.lru.MoveToFront(e.elem)
+	}
+	e.waiters++
+	memo.mu.Unlock()
 
-		e.res.value, e.res.err = memo.f(key)
+	select {
+	case <-e.ready: // wait for ready condition
+		return e.res.value, e.res.err
+	case <-ctx.Done():
+	}
 
-		close(e.ready) // broadcast ready condition
-	} else {
-		// This is a repeat request for this key.
-		memo.mu.Unlock()
+	memo.mu.Lock()
+	e.waiters--
+	if e.waiters == 0 {
+		select {
+		case <-e.ready:
+		default:
+			// No request is waiting, and the call has not
+			// finished: cancel it.
+			e.cancel()
+			memo.remove(e)
+		}
+	}
+	memo.mu.Unlock()
+	return value, ctx.Err()
+}
 
-		<-e.ready // wait for ready condition
+func (memo *Memo[K, V]) call(ctx context.Context, e *entry[K, V]) {
+	start := time.Now()
+	e.res.value, e.res.err = memo.f(ctx, e.key)
+	memo.stats.finished(start, e.res.err, ctx.Err() != nil)
+	memo.mu.Lock()
+	if ctx.Err() != nil {
+		// Don't cache the result of a cancelled call.
+		memo.remove(e)
+	} else if memo.cache[e.key] == e {
+		if memo.opts.cacheable(e.res.err) {
+			memo.add(e)
+		} else {
+			memo.remove(e)
+		}
 	}
-	return e.res.value, e.res.err
+	// Broadcast the ready condition while holding mu, so that a
+	// request that gives up sees ready closed once e is cached.
+	close(e.ready)
+	memo.mu.Unlock()
+	e.cancel() // release the context's resources
 }
 
 //!-
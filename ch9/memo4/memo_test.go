@@ -4,20 +4,145 @@
 package memo_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
 	"testing"
+	"time"
 
 	"gopl.io/ch9/memo4"
 	"gopl.io/ch9/memotest"
 )
 
-var httpGetBody = memotest.HTTPGetBody
+var httpGetBody = memotest.HTTPGetBodyContext
 
 func Test(t *testing.T) {
 	m := memo.New(httpGetBody)
-	memotest.Sequential(t, m)
+	memotest.Sequential(t, memotest.Background(m))
 }
 
 func TestConcurrent(t *testing.T) {
 	m := memo.New(httpGetBody)
-	memotest.Concurrent(t, m)
+	memotest.Concurrent(t, memotest.Background(m))
+}
+
+func TestCancel(t *testing.T) {
+	memotest.Cancel(t, func(f func(context.Context, string) (interface{}, error)) memotest.CM {
+		return memo.New(f)
+	})
+}
+
+func newWithOptions(f func(context.Context, string) (interface{}, error), opts memotest.Options) memotest.CM {
+	return memo.NewWithOptions(f, memo.Options[interface{}]{
+		MaxEntries: opts.MaxEntries,
+		MaxBytes:   opts.MaxBytes,
+		TTL:        opts.TTL,
+		Stale:      opts.Stale,
+		Errors:     memo.ErrorPolicy(opts.Errors),
+		ErrorTTL:   opts.ErrorTTL,
+		Retries:    opts.Retries,
+		Backoff:    opts.Backoff,
+		Permanent:  opts.Permanent,
+	})
+}
+
+func TestBounded(t *testing.T) { memotest.Bounded(t, newWithOptions) }
+
+// TestSize checks that Options.Size takes a value of the memo's type.
+func TestSize(t *testing.T) {
+	calls := 0
+	m := memo.NewWithOptions(func(ctx context.Context, key string) ([]int, error) {
+		calls++
+		return make([]int, len(key)), nil
+	}, memo.Options[[]int]{
+		MaxBytes: 24,
+		Size:     func(value []int) int64 { return 8 * int64(len(value)) },
+	})
+	for _, key := range []string{"a", "b", "b", "cc", "a"} {
+		if v, err := m.Get(context.Background(), key); err != nil || len(v) != len(key) {
+			t.Fatalf("Get(%q) = %v, %v", key, v, err)
+		}
+	}
+	// "cc" evicts "a", the least recently used, so "a" is computed anew.
+	if calls != 4 {
+		t.Errorf("f was called %d times, want 4", calls)
+	}
+}
+
+func TestErrors(t *testing.T) { memotest.Errors(t, newWithOptions) }
+
+var statsRuns int
+
+func TestStats(t *testing.T) {
+	errNegative := errors.New("negative")
+	release := make(chan struct{})
+	square := func(ctx context.Context, n int) (int, error) {
+		if n < 0 {
+			return 0, errNegative
+		}
+		if n == 0 {
+			<-release
+		}
+		return n * n, nil
+	}
+	m := memo.New(square)
+	statsRuns++ // expvar names must be unique, even with -count
+	name := fmt.Sprintf("memo4.TestStats.%d", statsRuns)
+	m.Publish(name)
+
+	for _, test := range []struct {
+		n, want int
+		err     error
+	}{
+		{2, 4, nil}, // miss
+		{2, 4, nil}, // hit
+		{3, 9, nil}, // miss
+		{-1, 0, errNegative},
+	} {
+		if got, err := m.Get(context.Background(), test.n); got != test.want || err != test.err {
+			t.Errorf("Get(%d) = %d, %v, want %d, %v", test.n, got, err, test.want, test.err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Get(context.Background(), 0)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().InFlight != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("call of f(0) is not in flight")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+
+	s := m.Stats()
+	if s.Hits != 1 || s.Misses != 4 || s.InFlight != 0 || s.Errors != 1 {
+		t.Errorf("Stats() = hits %d, misses %d, in flight %d, errors %d; want 1, 4, 0, 1",
+			s.Hits, s.Misses, s.InFlight, s.Errors)
+	}
+	if s.CallLatency.Count != 4 || s.GetLatency.Count != 5 {
+		t.Errorf("latencies counted %d calls and %d requests, want 4 and 5",
+			s.CallLatency.Count, s.GetLatency.Count)
+	}
+	var n int64
+	for _, c := range s.GetLatency.Buckets {
+		n += c
+	}
+	if n != s.GetLatency.Count {
+		t.Errorf("request latency buckets hold %d requests, want %d", n, s.GetLatency.Count)
+	}
+
+	var published memo.Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.Hits != 1 || published.Misses != 4 {
+		t.Errorf("published hits %d, misses %d, want 1, 4", published.Hits, published.Misses)
+	}
 }
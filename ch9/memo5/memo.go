@@ -7,22 +7,50 @@
 // of a function.  Requests for different keys proceed in parallel.
 // Concurrent requests for the same key block until the first completes.
 // This implementation uses a monitor goroutine.
+//
+// A request may be cancelled through its context.  A call of the
+// function is cancelled when every request waiting for it has been,
+// and its result is not cached.
+//
+// By default the memo keeps every entry forever; NewWithOptions
+// bounds the number or size of its entries and expires them,
+// and says whether to cache or retry the errors of the function.
+// Stats reports how effective the memo is, and Publish publishes
+// that through expvar.
 package memo
 
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
 //!+Func
 
 // Func is the type of the function to memoize.
-type Func func(key string) (interface{}, error)
+// It should return promptly when ctx is done.
+type Func[K comparable, V any] func(ctx context.Context, key K) (V, error)
 
 // A result is the result of calling a Func.
-type result struct {
-	value interface{}
+type result[V any] struct {
+	value V
 	err   error
 }
 
-type entry struct {
-	res   result
+type entry[K comparable, V any] struct {
+	res   result[V]
 	ready chan struct{} // closed when res is ready
+
+	key      K
+	replaces *entry[K, V] // the stale entry that a refresh replaces
+
+	// These fields belong to the monitor goroutine.
+	waiters    int                // requests waiting for res
+	cancel     context.CancelFunc // cancels the call of Func
+	elem       *list.Element      // in cache.lru, once res is ready and cached
+	size       int64              // of res.value, once cached
+	expires    time.Time          // once cached, if Options.TTL is set
+	refreshing bool               // a refresh of a stale value is in progress
 }
 
 //!-Func
@@ -30,59 +58,174 @@ type entry struct {
 //!+get
 
 // A request is a message requesting that the Func be applied to key.
-type request struct {
-	key      string
-	response chan<- result // the client wants a single result
+type request[K comparable, V any] struct {
+	ctx      context.Context
+	key      K
+	response chan<- result[V] // the client wants a single result
 }
 
-type Memo struct{ requests chan request }
+// A leave is a message that a request waiting for e
+// has been cancelled, or that the call for e was cancelled.
+type leave[K comparable, V any] struct {
+	e    *entry[K, V]
+	call bool // the call, not a request, was cancelled
+}
+
+type Memo[K comparable, V any] struct {
+	requests chan request[K, V]
+	leaves   chan leave[K, V]
+	readies  chan *entry[K, V] // entries whose calls have completed
+	done     chan struct{}     // closed when the monitor goroutine exits
+	stats    recorder
+}
 
 // New returns a memoization of f.  Clients must subsequently call Close.
-func New(f Func) *Memo {
-	memo := &Memo{requests: make(chan request)}
-	go memo.server(f)
+func New[K comparable, V any](f func(context.Context, K) (V, error)) *Memo[K, V] {
+	return NewWithOptions(f, Options[V]{})
+}
+
+// NewWithOptions returns a memoization of f that bounds and
+// expires its entries as opts specifies.  Clients must
+// subsequently call Close.
+func NewWithOptions[K comparable, V any](f func(context.Context, K) (V, error), opts Options[V]) *Memo[K, V] {
+	memo := &Memo[K, V]{
+		requests: make(chan request[K, V]),
+		leaves:   make(chan leave[K, V]),
+		readies:  make(chan *entry[K, V]),
+		done:     make(chan struct{}),
+	}
+	go memo.server(retrying(&opts, f), opts)
 	return memo
 }
 
-func (memo *Memo) Get(key string) (interface{}, error) {
-	response := make(chan result)
-	memo.requests <- request{key, response}
+// Get returns the result of f(key), calling f if needed,
+// or ctx.Err() if ctx is done first.
+func (memo *Memo[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if err := ctx.Err(); err != nil {
+		var zero V
+		return zero, err
+	}
+	defer memo.stats.got(time.Now())
+	response := make(chan result[V])
+	memo.requests <- request[K, V]{ctx, key, response}
 	res := <-response
 	return res.value, res.err
 }
 
-func (memo *Memo) Close() { close(memo.requests) }
+func (memo *Memo[K, V]) Close() { close(memo.requests) }
 
 //!-get
 
 //!+monitor
 
-func (memo *Memo) server(f Func) {
-	cache := make(map[string]*entry)
-	for req := range memo.requests {
-		e := cache[req.key]
-		if e == nil {
-			// This is the first request for this key.
-			e = &entry{ready: make(chan struct{})}
-			cache[req.key] = e
-			go e.call(f, req.key) // call f(key)
+func (memo *Memo[K, V]) server(f Func[K, V], opts Options[V]) {
+	defer close(memo.done)
+	cache := newCache[K, V](opts)
+	for {
+		select {
+		case req, ok := <-memo.requests:
+			if !ok {
+				return // closed
+			}
+			e := cache.entries[req.key]
+			if e != nil && e.elem != nil {
+				switch cache.state(e) {
+				case expired:
+					cache.remove(e)
+					e = nil
+				case stale:
+					if !e.refreshing {
+						// Serve the stale value, and refresh it.
+						e.refreshing = true
+						next, ctx := newEntry[K, V](req.key)
+						next.replaces = e
+						memo.stats.started()
+						go memo.call(ctx, next, f)
+					}
+				}
+			}
+			memo.stats.request(e != nil && e.elem != nil)
+			if e == nil {
+				// This is the first request for this key.
+				var ctx context.Context
+				e, ctx = newEntry[K, V](req.key)
+				cache.entries[req.key] = e
+				memo.stats.started()
+				go memo.call(ctx, e, f) // call f(ctx, key)
+			} else if e.elem != nil {
+				cache.lru.MoveToFront(e.elem)
+			}
+			e.waiters++
+			go memo.deliver(req, e)
+
+		case e := <-memo.readies:
+			cache.ready(e)
+
+		case l := <-memo.leaves:
+			if !l.call {
+				l.e.waiters--
+				select {
+				case <-l.e.ready:
+					continue // too late to cancel
+				default:
+				}
+				if l.e.waiters > 0 {
+					continue // other requests remain
+				}
+				l.e.cancel()
+			}
+			// Evict the cancelled entry.
+			cache.remove(l.e)
 		}
-		go e.deliver(req.response)
 	}
 }
 
-func (e *entry) call(f Func, key string) {
+// newEntry returns a new entry for key, and the
+// context for its call, which e.cancel cancels.
+func newEntry[K comparable, V any](key K) (*entry[K, V], context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &entry[K, V]{key: key, ready: make(chan struct{}), cancel: cancel}, ctx
+}
+
+func (memo *Memo[K, V]) call(ctx context.Context, e *entry[K, V], f Func[K, V]) {
 	// Evaluate the function.
-	e.res.value, e.res.err = f(key)
+	start := time.Now()
+	e.res.value, e.res.err = f(ctx, e.key)
+	cancelled := ctx.Err() != nil
+	memo.stats.finished(start, e.res.err, cancelled)
+	e.cancel() // release the context's resources
 	// Broadcast the ready condition.
 	close(e.ready)
+	if cancelled {
+		// Don't cache the result of a cancelled call.
+		memo.leave(leave[K, V]{e, true})
+		return
+	}
+	select {
+	case memo.readies <- e:
+	case <-memo.done:
+	}
 }
 
-func (e *entry) deliver(response chan<- result) {
-	// Wait for the ready condition.
-	<-e.ready
-	// Send the result to the client.
-	response <- e.res
+func (memo *Memo[K, V]) deliver(req request[K, V], e *entry[K, V]) {
+	// Wait for the ready condition, or cancellation.
+	select {
+	case <-e.ready:
+		// Send the result to the client.
+		req.response <- e.res
+	case <-req.ctx.Done():
+		memo.leave(leave[K, V]{e, false})
+		var zero V
+		req.response <- result[V]{zero, req.ctx.Err()}
+	}
+}
+
+// leave sends l to the monitor goroutine, unless it has exited.
+func (memo *Memo[K, V]) leave(l leave[K, V]) {
+	select {
+	case memo.leaves <- l:
+	case <-memo.done:
+	}
 }
 
 //!-monitor
@@ -0,0 +1,104 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memo
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Stats describes the effectiveness of a Memo.
+type Stats struct {
+	Hits     int64 // requests answered from the cache
+	Misses   int64 // requests that started or joined a call of Func
+	InFlight int64 // calls of Func in progress
+	Errors   int64 // calls of Func that failed, other than cancelled calls
+
+	CallLatency Histogram // of calls of Func
+	GetLatency  Histogram // of requests, including cancelled ones
+}
+
+// A Histogram counts durations in buckets.  Buckets[i] counts the
+// durations less than BucketBound(i) but not less than the bound of
+// the bucket before it; the last bucket counts the longest durations.
+type Histogram struct {
+	Count   int64
+	Sum     time.Duration
+	Buckets [20]int64
+}
+
+// BucketBound returns the upper bound of the durations
+// in bucket i of a Histogram: 10µs, 20µs, 40µs, and so on.
+func BucketBound(i int) time.Duration { return 10 * time.Microsecond << uint(i) }
+
+func (h *Histogram) add(d time.Duration) {
+	h.Count++
+	h.Sum += d
+	i := 0
+	for i < len(h.Buckets)-1 && d >= BucketBound(i) {
+		i++
+	}
+	h.Buckets[i]++
+}
+
+// Stats returns the statistics of the memo so far.
+func (memo *Memo[K, V]) Stats() Stats { return memo.stats.get() }
+
+// Publish publishes the statistics of the memo as the expvar
+// variable name, which /debug/vars shows as JSON.
+// Like expvar.Publish, it panics if name is already in use.
+func (memo *Memo[K, V]) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return memo.Stats() }))
+}
+
+// A recorder records the statistics of a Memo.
+type recorder struct {
+	mu sync.Mutex
+	s  Stats
+}
+
+func (r *recorder) get() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.s
+}
+
+// request records a request, which hit or missed the cache.
+func (r *recorder) request(hit bool) {
+	r.mu.Lock()
+	if hit {
+		r.s.Hits++
+	} else {
+		r.s.Misses++
+	}
+	r.mu.Unlock()
+}
+
+// got records the end of a request that began at start.
+func (r *recorder) got(start time.Time) {
+	d := time.Since(start)
+	r.mu.Lock()
+	r.s.GetLatency.add(d)
+	r.mu.Unlock()
+}
+
+// started records the start of a call of Func.
+func (r *recorder) started() {
+	r.mu.Lock()
+	r.s.InFlight++
+	r.mu.Unlock()
+}
+
+// finished records the end of a call of Func that began at start.
+func (r *recorder) finished(start time.Time, err error, cancelled bool) {
+	d := time.Since(start)
+	r.mu.Lock()
+	r.s.InFlight--
+	if err != nil && !cancelled {
+		r.s.Errors++
+	}
+	r.s.CallLatency.add(d)
+	r.mu.Unlock()
+}
@@ -0,0 +1,197 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memotest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Options mirrors the options of the memo packages.
+type Options struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL, Stale time.Duration
+
+	Errors    int // one of the policies below
+	ErrorTTL  time.Duration
+	Retries   int
+	Backoff   time.Duration
+	Permanent func(err error) bool
+}
+
+// The error policies of the memo packages, in their order.
+const (
+	CacheErrors = iota
+	NoCacheErrors
+	ExpireErrors
+	RetryErrors
+)
+
+// A countFunc is a function to memoize that returns, for each key,
+// the key followed by the number of the call, such as "a1".
+// If blocked is non-nil, calls for that key block until it is closed.
+type countFunc struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	block   string
+	blocked chan struct{}
+	started chan string // receives the key of each blocking call
+}
+
+func newCountFunc() *countFunc {
+	return &countFunc{calls: make(map[string]int), started: make(chan string, 100)}
+}
+
+func (f *countFunc) call(ctx context.Context, key string) (interface{}, error) {
+	f.mu.Lock()
+	f.calls[key]++
+	n := f.calls[key]
+	f.mu.Unlock()
+	if f.blocked != nil && key == f.block {
+		f.started <- key
+		select {
+		case <-f.blocked:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return fmt.Sprintf("%s%d", key, n), nil
+}
+
+func (f *countFunc) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[key]
+}
+
+// Bounded tests the eviction and expiry of the entries of the
+// memo returned by newMemo(f, opts):
+//
+// The least recently used entries are evicted to keep the number
+// of entries or their total size within bounds, but entries whose
+// values are still being computed are not.
+// Entries expire after a TTL, and stale values are refreshed
+// in the background.
+func Bounded(t *testing.T, newMemo func(f func(context.Context, string) (interface{}, error), opts Options) CM) {
+	type test struct {
+		name string
+		opts Options
+		run  func(t *testing.T, f *countFunc, get func(key string) interface{})
+	}
+	for _, test := range []test{
+		{"MaxEntries", Options{MaxEntries: 2}, func(t *testing.T, f *countFunc, get func(string) interface{}) {
+			get("a")
+			get("b")
+			get("a") // now b is the least recently used
+			get("c") // evicts b
+			if v := get("a"); v != "a1" {
+				t.Errorf("Get(a) = %v, want a1", v)
+			}
+			if v := get("b"); v != "b2" {
+				t.Errorf("Get(b) = %v, want b2 (evicted)", v)
+			}
+		}},
+		{"MaxBytes", Options{MaxBytes: 6}, func(t *testing.T, f *countFunc, get func(string) interface{}) {
+			get("a")  // 2 bytes
+			get("bb") // 3 bytes
+			get("c")  // 2 bytes; evicts a
+			if v := get("bb"); v != "bb1" {
+				t.Errorf("Get(bb) = %v, want bb1", v)
+			}
+			if v := get("a"); v != "a2" {
+				t.Errorf("Get(a) = %v, want a2 (evicted)", v)
+			}
+		}},
+		{"TTL", Options{TTL: 20 * time.Millisecond}, func(t *testing.T, f *countFunc, get func(string) interface{}) {
+			if v := get("a"); v != "a1" {
+				t.Errorf("Get(a) = %v, want a1", v)
+			}
+			if v := get("a"); v != "a1" {
+				t.Errorf("Get(a) = %v, want a1 (cached)", v)
+			}
+			time.Sleep(40 * time.Millisecond)
+			if v := get("a"); v != "a2" {
+				t.Errorf("Get(a) = %v, want a2 (expired)", v)
+			}
+		}},
+		{"Stale", Options{TTL: 20 * time.Millisecond, Stale: time.Hour}, func(t *testing.T, f *countFunc, get func(string) interface{}) {
+			get("a")
+			time.Sleep(40 * time.Millisecond)
+			if v := get("a"); v != "a1" {
+				t.Errorf("Get(a) = %v, want stale a1", v)
+			}
+			// The refresh replaces the stale value.
+			deadline := time.Now().Add(5 * time.Second)
+			for get("a") != "a2" {
+				if time.Now().After(deadline) {
+					t.Fatal("stale value was not refreshed")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if n := f.count("a"); n != 2 {
+				t.Errorf("f(a) was called %d times, want 2", n)
+			}
+		}},
+		{"InFlight", Options{MaxEntries: 1}, func(t *testing.T, f *countFunc, get func(string) interface{}) {
+			f.block = "slow"
+			f.blocked = make(chan struct{})
+			values := make(chan interface{}, 2)
+			go func() { values <- get("slow") }()
+			<-f.started
+			for _, key := range []string{"a", "b", "c"} {
+				get(key) // each evicts the last
+			}
+			go func() { values <- get("slow") }() // waits for the first call
+			time.Sleep(10 * time.Millisecond)
+			close(f.blocked)
+			for i := 0; i < 2; i++ {
+				if v := <-values; v != "slow1" {
+					t.Errorf("Get(slow) = %v, want slow1", v)
+				}
+			}
+			if n := f.count("slow"); n != 1 {
+				t.Errorf("f(slow) was called %d times, want 1", n)
+			}
+		}},
+		{"Contention", Options{MaxEntries: 10, TTL: time.Millisecond, Stale: time.Millisecond}, func(t *testing.T, f *countFunc, get func(string) interface{}) {
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(seed int64) {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(seed))
+					for j := 0; j < 200; j++ {
+						key := fmt.Sprint("k", rng.Intn(30))
+						v, _ := get(key).(string)
+						if len(v) <= len(key) || v[:len(key)] != key {
+							t.Errorf("Get(%s) = %q", key, v)
+						}
+					}
+				}(int64(i))
+			}
+			wg.Wait()
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newCountFunc()
+			m := newMemo(f.call, test.opts)
+			if c, ok := m.(interface{ Close() }); ok {
+				defer c.Close()
+			}
+			get := func(key string) interface{} {
+				v, err := m.Get(context.Background(), key)
+				if err != nil {
+					t.Errorf("Get(%s): %v", key, err)
+				}
+				return v
+			}
+			test.run(t, f, get)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memotest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A slowFunc is a function to memoize whose calls block until they
+// are released or cancelled.  It counts the calls for each key.
+type slowFunc struct {
+	mu        sync.Mutex
+	calls     map[string]int
+	started   chan string   // receives the key of each call
+	release   chan struct{} // closed to let calls return
+	cancelled chan string   // receives the key of each cancelled call
+}
+
+func newSlowFunc() *slowFunc {
+	return &slowFunc{
+		calls:     make(map[string]int),
+		started:   make(chan string, 100),
+		release:   make(chan struct{}),
+		cancelled: make(chan string, 100),
+	}
+}
+
+func (f *slowFunc) call(ctx context.Context, key string) (interface{}, error) {
+	f.mu.Lock()
+	f.calls[key]++
+	f.mu.Unlock()
+	f.started <- key
+	select {
+	case <-f.release:
+		return key + " value", nil
+	case <-ctx.Done():
+		f.cancelled <- key
+		return nil, ctx.Err()
+	}
+}
+
+func (f *slowFunc) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[key]
+}
+
+// Cancel tests the cancellation of requests to the memo returned by
+// newMemo(f):
+//
+// A request returns when its context is done.
+// A call of f is cancelled only when all its requests have been,
+// and then its result is not cached.
+func Cancel(t *testing.T, newMemo func(f func(context.Context, string) (interface{}, error)) CM) {
+	const timeout = 5 * time.Second
+	f := newSlowFunc()
+	m := newMemo(f.call)
+	if c, ok := m.(interface{ Close() }); ok {
+		defer c.Close()
+	}
+
+	// A request whose context is done returns at once,
+	// and cancels the call, which is not cached.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := m.Get(ctx, "a")
+		errc <- err
+	}()
+	<-f.started
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("cancelled Get returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(timeout):
+		t.Fatal("cancelled Get did not return")
+	}
+	select {
+	case <-f.cancelled:
+	case <-time.After(timeout):
+		t.Fatal("call was not cancelled when its only request was")
+	}
+
+	// Two requests share a call; the call survives the
+	// cancellation of one, and the other gets its value.
+	ctx, cancel = context.WithCancel(context.Background())
+	type response struct {
+		value interface{}
+		err   error
+	}
+	responses := make(chan response, 2)
+	get := func(ctx context.Context) {
+		value, err := m.Get(ctx, "a")
+		responses <- response{value, err}
+	}
+	go get(ctx)
+	<-f.started
+	go get(context.Background())
+	time.Sleep(10 * time.Millisecond) // let the second request join
+	cancel()
+	if r := <-responses; r.err != context.Canceled {
+		t.Errorf("cancelled Get returned %v, %v", r.value, r.err)
+	}
+	select {
+	case key := <-f.cancelled:
+		t.Errorf("call for %q was cancelled while a request remained", key)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(f.release)
+	if r := <-responses; r.value != "a value" || r.err != nil {
+		t.Errorf("Get returned %v, %v, want %q", r.value, r.err, "a value")
+	}
+	if n := f.count("a"); n != 2 {
+		t.Errorf("f(a) was called %d times, want 2 (the cancelled call is not cached)", n)
+	}
+
+	// Now the value is cached.
+	if value, err := m.Get(context.Background(), "a"); value != "a value" || err != nil {
+		t.Errorf("Get returned %v, %v, want %q", value, err, "a value")
+	}
+	if n := f.count("a"); n != 2 {
+		t.Errorf("f(a) was called %d times, want 2", n)
+	}
+
+	// A request whose context is already done does not call f.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Get(ctx, "b"); err != context.Canceled {
+		t.Errorf("Get with done context returned %v", err)
+	}
+	if n := f.count("b"); n != 0 {
+		t.Errorf("f(b) was called %d times with a done context", n)
+	}
+}
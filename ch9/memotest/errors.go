@@ -0,0 +1,134 @@
+// Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
+// License: https://creativecommons.org/licenses/by-nc-sa/4.0/
+
+package memotest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	errTransient = errors.New("transient")
+	errPermanent = errors.New("permanent")
+)
+
+func isPermanent(err error) bool { return err == errPermanent }
+
+// A flakyFunc is a function to memoize whose first fails calls for
+// each key return errTransient, and whose calls for the key "bad"
+// return errPermanent.  It counts the calls for each key.
+type flakyFunc struct {
+	fails int
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *flakyFunc) call(ctx context.Context, key string) (interface{}, error) {
+	f.mu.Lock()
+	f.calls[key]++
+	n := f.calls[key]
+	f.mu.Unlock()
+	switch {
+	case key == "bad":
+		return nil, errPermanent
+	case n <= f.fails:
+		return nil, errTransient
+	}
+	return key + " value", nil
+}
+
+func (f *flakyFunc) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[key]
+}
+
+// Errors tests the error policies of the memo returned by
+// newMemo(f, opts): errors are cached, not cached, cached for a
+// time, or retried, except that permanent errors are always cached.
+func Errors(t *testing.T, newMemo func(f func(context.Context, string) (interface{}, error), opts Options) CM) {
+	type get struct {
+		key   string
+		sleep time.Duration // before the request
+		err   error         // want
+		calls int           // want, after the request
+	}
+	for _, test := range []struct {
+		name  string
+		opts  Options
+		fails int
+		gets  []get
+	}{
+		{"CacheErrors", Options{Errors: CacheErrors}, 1, []get{
+			{"a", 0, errTransient, 1},
+			{"a", 0, errTransient, 1},
+		}},
+		{"NoCacheErrors", Options{Errors: NoCacheErrors, Permanent: isPermanent}, 1, []get{
+			{"a", 0, errTransient, 1},
+			{"a", 0, nil, 2},
+			{"a", 0, nil, 2},
+			{"bad", 0, errPermanent, 1},
+			{"bad", 0, errPermanent, 1},
+		}},
+		{"ExpireErrors", Options{Errors: ExpireErrors, ErrorTTL: 20 * time.Millisecond}, 1, []get{
+			{"a", 0, errTransient, 1},
+			{"a", 0, errTransient, 1},
+			{"a", 40 * time.Millisecond, nil, 2},
+			{"a", 40 * time.Millisecond, nil, 2}, // values don't expire
+		}},
+		{"RetryErrors", Options{Errors: RetryErrors, Retries: 2, Backoff: time.Millisecond}, 2, []get{
+			{"a", 0, nil, 3},
+			{"a", 0, nil, 3},
+		}},
+		{"RetryErrorsFail", Options{Errors: RetryErrors, Retries: 2, Backoff: time.Millisecond, Permanent: isPermanent}, 5, []get{
+			{"a", 0, errTransient, 3},
+			{"a", 0, nil, 6}, // the last error is not cached
+			{"bad", 0, errPermanent, 1},
+			{"bad", 0, errPermanent, 1},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := &flakyFunc{fails: test.fails, calls: make(map[string]int)}
+			m := newMemo(f.call, test.opts)
+			if c, ok := m.(interface{ Close() }); ok {
+				defer c.Close()
+			}
+			for i, g := range test.gets {
+				time.Sleep(g.sleep)
+				if _, err := m.Get(context.Background(), g.key); err != g.err {
+					t.Errorf("#%d: Get(%s) returned error %v, want %v", i, g.key, err, g.err)
+				}
+				if n := f.count(g.key); n != g.calls {
+					t.Errorf("#%d: f(%s) was called %d times, want %d", i, g.key, n, g.calls)
+				}
+			}
+		})
+	}
+
+	// Concurrent requests share the retries of a single call.
+	t.Run("SharedRetries", func(t *testing.T) {
+		f := &flakyFunc{fails: 2, calls: make(map[string]int)}
+		m := newMemo(f.call, Options{Errors: RetryErrors, Retries: 2, Backoff: 10 * time.Millisecond})
+		if c, ok := m.(interface{ Close() }); ok {
+			defer c.Close()
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if value, err := m.Get(context.Background(), "a"); err != nil {
+					t.Errorf("Get(a) = %v, %v", value, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := f.count("a"); n != 3 {
+			t.Errorf("f(a) was called %d times, want 3", n)
+		}
+	})
+}
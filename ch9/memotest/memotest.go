@@ -8,6 +8,7 @@
 package memotest
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -31,6 +32,21 @@ func httpGetBody(url string) (interface{}, error) {
 
 var HTTPGetBody = httpGetBody
 
+// HTTPGetBodyContext is like HTTPGetBody but abandons the request
+// when ctx is done.
+func HTTPGetBodyContext(ctx context.Context, url string) (interface{}, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
 func incomingURLs() <-chan string {
 	ch := make(chan string)
 	go func() {
@@ -55,6 +71,20 @@ type M interface {
 	Get(key string) (interface{}, error)
 }
 
+// CM is the interface of a memo whose requests may be cancelled.
+type CM interface {
+	Get(ctx context.Context, key string) (interface{}, error)
+}
+
+// Background returns an M that calls m.Get with context.Background.
+func Background(m CM) M { return background{m} }
+
+type background struct{ m CM }
+
+func (b background) Get(key string) (interface{}, error) {
+	return b.m.Get(context.Background(), key)
+}
+
 /*
 //!+seq
 	m := memo.New(httpGetBody)